@@ -0,0 +1,466 @@
+package yagnats
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/yagnats/internal/subjects"
+	nats "github.com/nats-io/nats.go"
+)
+
+var ErrNotSupportedByClient = errors.New("not supported by the yagnats client")
+
+// ErrInvalidSubject is what nats-server reports for a SUB it rejects.
+var ErrInvalidSubject = errors.New("Invalid Subject")
+
+// NATSClientFromConn adapts a NATSConn to the NATSClient interface. The
+// NATSConn manages its own connection, so Connect and
+// BeforeConnectCallback do nothing.
+func NATSClientFromConn(conn NATSConn) NATSClient {
+	return &connClient{
+		conn:          conn,
+		subscriptions: map[int64]*nats.Subscription{},
+		lock:          &sync.Mutex{},
+	}
+}
+
+type connClient struct {
+	conn NATSConn
+
+	subscriptions       map[int64]*nats.Subscription
+	subscriptionCounter int64
+	lock                *sync.Mutex
+}
+
+// connection is nil until a client created by NewClientWithNATSGo connects.
+func (c *connClient) connection() NATSConn {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.conn
+}
+
+func (c *connClient) Ping() bool {
+	conn := c.connection()
+	return conn != nil && conn.Ping()
+}
+
+func (c *connClient) Connect(ConnectionProvider) error {
+	return nil
+}
+
+func (c *connClient) Disconnect() {
+	conn := c.connection()
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+func (c *connClient) Publish(subject string, payload []byte) error {
+	return c.PublishWithReplyTo(subject, "", payload)
+}
+
+func (c *connClient) PublishWithReplyTo(subject, reply string, payload []byte) error {
+	conn := c.connection()
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	return conn.PublishRequest(subject, reply, payload)
+}
+
+func (c *connClient) Subscribe(subject string, callback Callback) (int64, error) {
+	return c.SubscribeWithQueue(subject, "", callback)
+}
+
+func (c *connClient) SubscribeWithQueue(subject, queue string, callback Callback) (int64, error) {
+	handler := func(msg *nats.Msg) {
+		callback(
+			&Message{
+				Subject: msg.Subject,
+				ReplyTo: msg.Reply,
+				Header:  Header(msg.Header),
+				Payload: msg.Data,
+			},
+		)
+	}
+
+	conn := c.connection()
+	if conn == nil {
+		return -1, ErrNotConnected
+	}
+
+	// nats.go leaves subjects to the server, which rejects them
+	// asynchronously and closes the connection
+	if !subjects.Valid(subject) {
+		return -1, ErrInvalidSubject
+	}
+
+	var sub *nats.Subscription
+	var err error
+
+	if queue == "" {
+		sub, err = conn.Subscribe(subject, handler)
+	} else {
+		sub, err = conn.QueueSubscribe(subject, queue, handler)
+	}
+
+	if err != nil {
+		return -1, err
+	}
+
+	c.lock.Lock()
+	c.subscriptionCounter++
+	id := c.subscriptionCounter
+	c.subscriptions[id] = sub
+	c.lock.Unlock()
+
+	return id, nil
+}
+
+func (c *connClient) Unsubscribe(sid int64) error {
+	c.lock.Lock()
+	conn := c.conn
+	sub := c.subscriptions[sid]
+	delete(c.subscriptions, sid)
+	c.lock.Unlock()
+
+	if sub == nil {
+		return nil
+	}
+
+	return conn.Unsubscribe(sub)
+}
+
+func (c *connClient) UnsubscribeAll(subject string) {
+	idsToUnsubscribe := []int64{}
+	c.lock.Lock()
+	for id, sub := range c.subscriptions {
+		if sub.Subject == subject {
+			idsToUnsubscribe = append(idsToUnsubscribe, id)
+		}
+	}
+	c.lock.Unlock()
+
+	for _, id := range idsToUnsubscribe {
+		c.Unsubscribe(id)
+	}
+}
+
+func (c *connClient) BeforeConnectCallback(func()) {}
+
+// NATSConnFromClient adapts a Client to the NATSConn interface. It takes
+// over the client's ConnectedCallback, DisconnectedCallback and
+// LameDuckCallback, chaining any that are already set, so adapt a client
+// after connecting it or reconnected callbacks also see the first connect.
+// SubscribeSync is not supported, and discovered server and async error
+// callbacks never fire. Options only reports the servers, user, TLS and
+// ping interval the client was connected with; the remaining fields are
+// left at their zero values.
+func NATSConnFromClient(client *Client) NATSConn {
+	c := &clientConn{
+		client:        client,
+		subscriptions: map[*nats.Subscription]int64{},
+		lock:          &sync.Mutex{},
+
+		reconnectCbs:    newCallbacks[func(*nats.Conn)](),
+		closedCbs:       newCallbacks[func(*nats.Conn)](),
+		disconnectedCbs: newCallbacks[func(*nats.Conn)](),
+		discoveredCbs:   newCallbacks[func(*nats.Conn)](),
+		lameDuckCbs:     newCallbacks[func(*nats.Conn)](),
+		errorCbs:        newCallbacks[func(*nats.Conn, *nats.Subscription, error)](),
+	}
+
+	client.lock.Lock()
+	client.ConnectedCallback = chainCallback(client.ConnectedCallback, c.reconnectCbs)
+	client.DisconnectedCallback = chainCallback(client.DisconnectedCallback, c.disconnectedCbs)
+	client.LameDuckCallback = chainCallback(client.LameDuckCallback, c.lameDuckCbs)
+	client.lock.Unlock()
+
+	return c
+}
+
+func chainCallback(existing func(), cbs *callbacks[func(*nats.Conn)]) func() {
+	return func() {
+		if existing != nil {
+			existing()
+		}
+
+		for _, cb := range cbs.snapshot() {
+			cb(nil)
+		}
+	}
+}
+
+type clientConn struct {
+	client *Client
+
+	subscriptions map[*nats.Subscription]int64
+	lock          *sync.Mutex
+
+	reconnectCbs    *callbacks[func(*nats.Conn)]
+	closedCbs       *callbacks[func(*nats.Conn)]
+	disconnectedCbs *callbacks[func(*nats.Conn)]
+	discoveredCbs   *callbacks[func(*nats.Conn)]
+	lameDuckCbs     *callbacks[func(*nats.Conn)]
+	errorCbs        *callbacks[func(*nats.Conn, *nats.Subscription, error)]
+}
+
+func (c *clientConn) Close() {
+	c.client.Disconnect()
+
+	for _, cb := range c.closedCbs.snapshot() {
+		cb(nil)
+	}
+}
+
+func (c *clientConn) Publish(subject string, data []byte) error {
+	return c.client.Publish(subject, data)
+}
+
+func (c *clientConn) PublishRequest(subject, reply string, data []byte) error {
+	return c.client.PublishWithReplyTo(subject, reply, data)
+}
+
+func (c *clientConn) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return c.QueueSubscribe(subject, "", handler)
+}
+
+func (c *clientConn) QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	sid, err := c.client.SubscribeWithQueue(subject, queue, func(msg *Message) {
+		handler(
+			&nats.Msg{
+				Subject: msg.Subject,
+				Reply:   msg.ReplyTo,
+				Header:  nats.Header(msg.Header),
+				Data:    msg.Payload,
+			},
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &nats.Subscription{Subject: subject, Queue: queue}
+
+	c.lock.Lock()
+	c.subscriptions[sub] = sid
+	c.lock.Unlock()
+
+	return sub, nil
+}
+
+func (c *clientConn) ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return c.Subscribe(subject, func(msg *nats.Msg) {
+		ch <- msg
+	})
+}
+
+func (c *clientConn) SubscribeSync(string) (*nats.Subscription, error) {
+	return nil, ErrNotSupportedByClient
+}
+
+func (c *clientConn) Unsubscribe(sub *nats.Subscription) error {
+	c.lock.Lock()
+	sid, ok := c.subscriptions[sub]
+	delete(c.subscriptions, sub)
+	c.lock.Unlock()
+
+	if !ok {
+		return nats.ErrBadSubscription
+	}
+
+	return c.client.Unsubscribe(sid)
+}
+
+func (c *clientConn) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msg, err := c.RequestWithContext(ctx, subject, data)
+	if err == context.DeadlineExceeded {
+		return nil, nats.ErrTimeout
+	}
+
+	return msg, err
+}
+
+func (c *clientConn) RequestWithContext(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	return c.RequestMsgWithContext(ctx, &nats.Msg{Subject: subject, Data: data})
+}
+
+// RequestMsgWithContext is RequestWithContext for a message with headers, as
+// on nats.Conn. The request is published with ctx, so the client's publish
+// middleware sees the caller's context.
+func (c *clientConn) RequestMsgWithContext(ctx context.Context, msg *nats.Msg) (*nats.Msg, error) {
+	responses := make(chan *nats.Msg, 1)
+
+	inbox, err := c.Subscribe(nats.NewInbox(), func(msg *nats.Msg) {
+		select {
+		case responses <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.Unsubscribe(inbox)
+
+	request := &Message{
+		Subject: msg.Subject,
+		ReplyTo: inbox.Subject,
+		Header:  Header(msg.Header),
+		Payload: msg.Data,
+	}
+
+	err = c.client.PublishMsg(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-responses:
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *clientConn) Flush() error {
+	_, err := c.client.RTT()
+	return err
+}
+
+func (c *clientConn) FlushTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return nats.ErrBadTimeout
+	}
+
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- c.Flush()
+	}()
+
+	select {
+	case err := <-flushed:
+		return err
+	case <-time.After(timeout):
+		return nats.ErrTimeout
+	}
+}
+
+func (c *clientConn) Drain() error {
+	c.Close()
+	return nil
+}
+
+func (c *clientConn) Ping() bool {
+	return c.client.Ping()
+}
+
+func (c *clientConn) Status() nats.Status {
+	c.client.lock.Lock()
+	defer c.client.lock.Unlock()
+
+	switch {
+	case c.client.disconnecting:
+		return nats.CLOSED
+	case c.client.connecting:
+		return nats.CONNECTING
+	case !c.client.connected:
+		return nats.DISCONNECTED
+	case c.client.reconnecting:
+		return nats.RECONNECTING
+	default:
+		return nats.CONNECTED
+	}
+}
+
+func (c *clientConn) Stats() nats.Statistics {
+	stats := c.client.Statistics()
+
+	return nats.Statistics{
+		InMsgs:     stats.InMsgs,
+		OutMsgs:    stats.OutMsgs,
+		InBytes:    stats.InBytes,
+		OutBytes:   stats.OutBytes,
+		Reconnects: stats.Reconnects,
+	}
+}
+
+func (c *clientConn) ConnectedUrl() string {
+	select {
+	case conn := <-c.client.connection:
+		if strings.Contains(conn.addr, "://") {
+			return conn.addr
+		}
+		return "nats://" + conn.addr
+	case <-time.After(500 * time.Millisecond):
+		return ""
+	}
+}
+
+func (c *clientConn) LastError() error {
+	return c.client.Statistics().LastError
+}
+
+func (c *clientConn) AddReconnectedCB(handler func(*nats.Conn)) func() {
+	return c.reconnectCbs.add(handler)
+}
+
+func (c *clientConn) AddClosedCB(handler func(*nats.Conn)) func() {
+	return c.closedCbs.add(handler)
+}
+
+func (c *clientConn) AddDisconnectedCB(handler func(*nats.Conn)) func() {
+	return c.disconnectedCbs.add(handler)
+}
+
+func (c *clientConn) AddDiscoveredServersCB(handler func(*nats.Conn)) func() {
+	return c.discoveredCbs.add(handler)
+}
+
+func (c *clientConn) AddLameDuckModeCB(handler func(*nats.Conn)) func() {
+	return c.lameDuckCbs.add(handler)
+}
+
+func (c *clientConn) AddErrorCB(handler func(*nats.Conn, *nats.Subscription, error)) func() {
+	return c.errorCbs.add(handler)
+}
+
+func (c *clientConn) Options() nats.Options {
+	c.client.lock.Lock()
+	provider := c.client.provider
+	c.client.lock.Unlock()
+
+	opts := nats.Options{
+		AllowReconnect: true,
+		MaxReconnect:   -1,
+		PingInterval:   c.client.PingInterval,
+	}
+
+	// providers other than ConnectionInfo, ConnectionCluster and
+	// ChaosConnectionProvider leave the servers unknown
+	members, _ := connectionInfos(provider)
+	for _, member := range members {
+		server, err := member.natsURL()
+		if err != nil {
+			continue
+		}
+
+		server.User = nil
+		opts.Servers = append(opts.Servers, server.String())
+
+		if opts.User == "" {
+			opts.User = member.Username
+		}
+
+		if member.TLSInfo != nil {
+			opts.Secure = true
+		}
+	}
+
+	return opts
+}
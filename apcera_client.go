@@ -1,6 +1,7 @@
 package yagnats
 
 import (
+	"context"
 	"sync"
 	"time"
 
@@ -14,61 +15,92 @@ type NATSConn interface {
 	Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error)
 	QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error)
 	Unsubscribe(sub *nats.Subscription) error
+	ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error)
+	SubscribeSync(subject string) (*nats.Subscription, error)
+	Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error)
+	RequestWithContext(ctx context.Context, subject string, data []byte) (*nats.Msg, error)
+	Flush() error
+	FlushTimeout(timeout time.Duration) error
+	Drain() error
 	Ping() bool
-	AddReconnectedCB(func(*nats.Conn))
-	AddClosedCB(func(*nats.Conn))
-	AddDisconnectedCB(func(*nats.Conn))
+	Status() nats.Status
+	Stats() nats.Statistics
+	ConnectedUrl() string
+	LastError() error
+
+	// The Add*CB methods return a func that removes the callback again.
+	AddReconnectedCB(func(*nats.Conn)) func()
+	AddClosedCB(func(*nats.Conn)) func()
+	AddDisconnectedCB(func(*nats.Conn)) func()
+	AddDiscoveredServersCB(func(*nats.Conn)) func()
+	AddLameDuckModeCB(func(*nats.Conn)) func()
+	AddErrorCB(func(*nats.Conn, *nats.Subscription, error)) func()
+
 	Options() nats.Options
 }
 
 type apceraNATSWrapper struct {
 	*nats.Conn
-	reconnectCbs    *[]func(*nats.Conn)
-	closedCbs       *[]func(*nats.Conn)
-	disconnectedCbs *[]func(*nats.Conn)
-	*sync.Mutex
+	reconnectCbs    *callbacks[func(*nats.Conn)]
+	closedCbs       *callbacks[func(*nats.Conn)]
+	disconnectedCbs *callbacks[func(*nats.Conn)]
+	discoveredCbs   *callbacks[func(*nats.Conn)]
+	lameDuckCbs     *callbacks[func(*nats.Conn)]
+	errorCbs        *callbacks[func(*nats.Conn, *nats.Subscription, error)]
 }
 
 func newApceraClient() *apceraNATSWrapper {
-	reconnectCallbacks := make([]func(*nats.Conn), 0)
-	closedCallbacks := make([]func(*nats.Conn), 0)
-	disconnectedCallbacks := make([]func(*nats.Conn), 0)
-
 	return &apceraNATSWrapper{
-		nil,
-		&reconnectCallbacks,
-		&closedCallbacks,
-		&disconnectedCallbacks,
-		&sync.Mutex{},
+		reconnectCbs:    newCallbacks[func(*nats.Conn)](),
+		closedCbs:       newCallbacks[func(*nats.Conn)](),
+		disconnectedCbs: newCallbacks[func(*nats.Conn)](),
+		discoveredCbs:   newCallbacks[func(*nats.Conn)](),
+		lameDuckCbs:     newCallbacks[func(*nats.Conn)](),
+		errorCbs:        newCallbacks[func(*nats.Conn, *nats.Subscription, error)](),
 	}
 }
 
-func Connect(urls []string) (NATSConn, error) {
-	options := DefaultOptions()
-	options.Servers = urls
-
-	s := newApceraClient()
-
-	options.ReconnectedCB = s.apceraReconnectCB
-	options.ClosedCB = s.apceraClosedCB
-	options.DisconnectedCB = s.apceraDisconnectedCB
-
-	conn, err := options.Connect()
-	if err != nil {
-		return nil, err
-	}
-
-	s.Conn = conn
-	return s, nil
-}
-
+// ConnectWithOptions connects with opts. Callbacks already set in opts are
+// kept and run before any added later through the Add*CB methods.
 func ConnectWithOptions(urls []string, opts nats.Options) (NATSConn, error) {
 	opts.Servers = urls
 	s := newApceraClient()
 
+	if opts.ReconnectedCB != nil {
+		s.AddReconnectedCB(opts.ReconnectedCB)
+	}
+	if opts.ClosedCB != nil {
+		s.AddClosedCB(opts.ClosedCB)
+	}
+	if opts.DisconnectedCB != nil {
+		s.AddDisconnectedCB(opts.DisconnectedCB)
+	}
+	if opts.DiscoveredServersCB != nil {
+		s.AddDiscoveredServersCB(opts.DiscoveredServersCB)
+	}
+	if opts.LameDuckModeHandler != nil {
+		s.AddLameDuckModeCB(opts.LameDuckModeHandler)
+	}
+	if opts.AsyncErrorCB != nil {
+		s.AddErrorCB(opts.AsyncErrorCB)
+	}
+
 	opts.ReconnectedCB = s.apceraReconnectCB
 	opts.ClosedCB = s.apceraClosedCB
-	opts.DisconnectedCB = s.apceraDisconnectedCB
+	// nats.go skips DisconnectedCB when DisconnectedErrCB is set, so both
+	// run from the latter
+	disconnectedErrCB := opts.DisconnectedErrCB
+	opts.DisconnectedCB = nil
+	opts.DisconnectedErrCB = func(conn *nats.Conn, err error) {
+		if disconnectedErrCB != nil {
+			disconnectedErrCB(conn, err)
+		}
+
+		s.apceraDisconnectedCB(conn)
+	}
+	opts.DiscoveredServersCB = s.apceraDiscoveredServersCB
+	opts.LameDuckModeHandler = s.apceraLameDuckModeCB
+	opts.AsyncErrorCB = s.apceraErrorCB
 
 	conn, err := opts.Connect()
 	if err != nil {
@@ -77,7 +109,6 @@ func ConnectWithOptions(urls []string, opts nats.Options) (NATSConn, error) {
 
 	s.Conn = conn
 	return s, nil
-
 }
 
 func DefaultOptions() nats.Options {
@@ -88,32 +119,32 @@ func DefaultOptions() nats.Options {
 	return options
 }
 
-func (c *apceraNATSWrapper) AddReconnectedCB(handler func(*nats.Conn)) {
-	c.Lock()
-	defer c.Unlock()
-	callbacks := *c.reconnectCbs
-	callbacks = append(callbacks, handler)
-	c.reconnectCbs = &callbacks
+func (c *apceraNATSWrapper) AddReconnectedCB(handler func(*nats.Conn)) func() {
+	return c.reconnectCbs.add(handler)
 }
 
 func (c *apceraNATSWrapper) Options() nats.Options {
 	return c.Conn.Opts
 }
 
-func (c *apceraNATSWrapper) AddClosedCB(handler func(*nats.Conn)) {
-	c.Lock()
-	defer c.Unlock()
-	callbacks := *c.closedCbs
-	callbacks = append(callbacks, handler)
-	c.closedCbs = &callbacks
+func (c *apceraNATSWrapper) AddClosedCB(handler func(*nats.Conn)) func() {
+	return c.closedCbs.add(handler)
 }
 
-func (c *apceraNATSWrapper) AddDisconnectedCB(handler func(*nats.Conn)) {
-	c.Lock()
-	defer c.Unlock()
-	callbacks := *c.disconnectedCbs
-	callbacks = append(callbacks, handler)
-	c.disconnectedCbs = &callbacks
+func (c *apceraNATSWrapper) AddDisconnectedCB(handler func(*nats.Conn)) func() {
+	return c.disconnectedCbs.add(handler)
+}
+
+func (c *apceraNATSWrapper) AddDiscoveredServersCB(handler func(*nats.Conn)) func() {
+	return c.discoveredCbs.add(handler)
+}
+
+func (c *apceraNATSWrapper) AddLameDuckModeCB(handler func(*nats.Conn)) func() {
+	return c.lameDuckCbs.add(handler)
+}
+
+func (c *apceraNATSWrapper) AddErrorCB(handler func(*nats.Conn, *nats.Subscription, error)) func() {
+	return c.errorCbs.add(handler)
 }
 
 func (c *apceraNATSWrapper) Unsubscribe(sub *nats.Subscription) error {
@@ -125,26 +156,105 @@ func (c *apceraNATSWrapper) Ping() bool {
 	return err == nil
 }
 
+func (c *apceraNATSWrapper) RTT() (time.Duration, error) {
+	start := time.Now()
+
+	err := c.FlushTimeout(500 * time.Millisecond)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
+
 func (c *apceraNATSWrapper) apceraReconnectCB(conn *nats.Conn) {
-	c.Lock()
-	defer c.Unlock()
-	for _, cb := range *c.reconnectCbs {
+	for _, cb := range c.reconnectCbs.snapshot() {
 		cb(conn)
 	}
 }
 
 func (c *apceraNATSWrapper) apceraClosedCB(conn *nats.Conn) {
-	c.Lock()
-	defer c.Unlock()
-	for _, cb := range *c.closedCbs {
+	for _, cb := range c.closedCbs.snapshot() {
 		cb(conn)
 	}
 }
 
 func (c *apceraNATSWrapper) apceraDisconnectedCB(conn *nats.Conn) {
-	c.Lock()
-	defer c.Unlock()
-	for _, cb := range *c.disconnectedCbs {
+	for _, cb := range c.disconnectedCbs.snapshot() {
 		cb(conn)
 	}
 }
+
+func (c *apceraNATSWrapper) apceraDiscoveredServersCB(conn *nats.Conn) {
+	for _, cb := range c.discoveredCbs.snapshot() {
+		cb(conn)
+	}
+}
+
+func (c *apceraNATSWrapper) apceraLameDuckModeCB(conn *nats.Conn) {
+	for _, cb := range c.lameDuckCbs.snapshot() {
+		cb(conn)
+	}
+}
+
+func (c *apceraNATSWrapper) apceraErrorCB(conn *nats.Conn, sub *nats.Subscription, err error) {
+	for _, cb := range c.errorCbs.snapshot() {
+		cb(conn, sub, err)
+	}
+}
+
+// callbacks is a copy-on-write list of handlers. Handlers are called
+// without holding the lock, so they may add or remove callbacks themselves.
+type callbacks[F any] struct {
+	entries []callbackEntry[F]
+	nextID  uint64
+	lock    *sync.Mutex
+}
+
+type callbackEntry[F any] struct {
+	id      uint64
+	handler F
+}
+
+func newCallbacks[F any]() *callbacks[F] {
+	return &callbacks[F]{lock: &sync.Mutex{}}
+}
+
+func (c *callbacks[F]) add(handler F) func() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nextID++
+	id := c.nextID
+
+	entries := make([]callbackEntry[F], len(c.entries), len(c.entries)+1)
+	copy(entries, c.entries)
+	c.entries = append(entries, callbackEntry[F]{id: id, handler: handler})
+
+	return func() { c.remove(id) }
+}
+
+func (c *callbacks[F]) remove(id uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entries := make([]callbackEntry[F], 0, len(c.entries))
+	for _, entry := range c.entries {
+		if entry.id != id {
+			entries = append(entries, entry)
+		}
+	}
+	c.entries = entries
+}
+
+func (c *callbacks[F]) snapshot() []F {
+	c.lock.Lock()
+	entries := c.entries
+	c.lock.Unlock()
+
+	handlers := make([]F, len(entries))
+	for i, entry := range entries {
+		handlers[i] = entry.handler
+	}
+	return handlers
+}
@@ -0,0 +1,9 @@
+// Package assets embeds the certificates in this directory, which
+// generate.sh produces. Their private keys are public, so they are only fit
+// for tests.
+package assets
+
+import "embed"
+
+//go:embed *.pem
+var FS embed.FS
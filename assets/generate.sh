@@ -0,0 +1,50 @@
+#!/bin/bash
+
+# Regenerates the certificates used by the TLS integration tests. They are
+# valid for 100 years so that the suite does not start failing when they
+# expire, as the previous set did in 2018 and 2020.
+
+set -e
+
+cd "$(dirname "$0")"
+
+days=36500
+subject="/C=US/O=Cloud Foundry"
+
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+ca() {
+  local name=$1
+
+  openssl req -x509 -newkey rsa:3072 -nodes -sha256 -days $days \
+    -subj "$subject" \
+    -addext "basicConstraints=critical,CA:TRUE" \
+    -addext "keyUsage=critical,keyCertSign,cRLSign" \
+    -keyout "$tmp/$name-key.pem" -out "$name.pem"
+}
+
+leaf() {
+  local ca=$1 cert=$2 key=$3 subj=$4 extensions=$5
+
+  openssl genrsa -traditional -out "$key" 3072
+  openssl req -new -key "$key" -subj "$subj" -out "$tmp/leaf.csr"
+
+  printf '%b' "$extensions" > "$tmp/leaf.ext"
+
+  openssl x509 -req -sha256 -days $days \
+    -in "$tmp/leaf.csr" -CA "$ca.pem" -CAkey "$tmp/$ca-key.pem" -CAserial "$tmp/$ca.srl" -CAcreateserial \
+    -extfile "$tmp/leaf.ext" -out "$cert"
+}
+
+ca ca
+ca invalid-ca
+
+leaf ca server-cert.pem server-pkey.pem "$subject/CN=localhost" \
+  "basicConstraints=critical,CA:FALSE\nkeyUsage=critical,digitalSignature,keyEncipherment\nextendedKeyUsage=serverAuth\nsubjectAltName=IP:127.0.0.1\n"
+
+leaf ca client-cert.pem client-pkey.pem "$subject" \
+  "basicConstraints=critical,CA:FALSE\nkeyUsage=critical,digitalSignature,keyEncipherment\nextendedKeyUsage=clientAuth\n"
+
+leaf invalid-ca client-invalid-cert.pem client-invalid-pkey.pem "$subject" \
+  "basicConstraints=critical,CA:FALSE\nkeyUsage=critical,digitalSignature,keyEncipherment\nextendedKeyUsage=clientAuth\n"
@@ -0,0 +1,238 @@
+package yagnats
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInjectedDialFailure = errors.New("injected dial failure")
+	ErrInjectedDisconnect  = errors.New("injected disconnect")
+)
+
+// ChaosConnectionProvider wraps a ConnectionProvider and injects faults,
+// for testing how code copes with a flaky network. Only dial failures apply
+// to every provider; the other faults are injected into the connections of
+// ConnectionInfo providers, including those in a ConnectionCluster, and
+// other providers' connections pass through untouched. The same faults
+// apply when it is given to a client from NewClientWithNATSGo.
+//
+// Random decisions are reproducible from the seed given to
+// NewChaosConnectionProvider. Dials draw from one RNG, which also seeds a
+// separate RNG for each direction of every connection it dials, so a run
+// that dials in the same order and reads and writes the same data on each
+// connection sees the same faults however its goroutines are scheduled.
+type ChaosConnectionProvider struct {
+	Provider ConnectionProvider
+
+	// DialFailureRate is the probability of ProvideConnection failing with
+	// ErrInjectedDialFailure without dialing.
+	DialFailureRate float64
+
+	// HandshakeDelay is waited before the first read from a connection,
+	// holding up the server's INFO.
+	HandshakeDelay time.Duration
+
+	// ReadLatency and WriteLatency are added to every read and write.
+	ReadLatency  time.Duration
+	WriteLatency time.Duration
+
+	// DisconnectRate is the probability of a read or write closing the
+	// connection and failing with ErrInjectedDisconnect.
+	DisconnectRate float64
+
+	// PartialWriteRate is the probability of a write sending only part of
+	// its bytes before closing the connection with io.ErrShortWrite.
+	PartialWriteRate float64
+
+	// CorruptionRate is the probability of a read or write flipping the
+	// bits of one of its bytes.
+	CorruptionRate float64
+
+	dials *chaosRandom
+}
+
+func NewChaosConnectionProvider(provider ConnectionProvider, seed int64) *ChaosConnectionProvider {
+	return &ChaosConnectionProvider{
+		Provider: provider,
+
+		dials: newChaosRandom(seed),
+	}
+}
+
+func (c *ChaosConnectionProvider) ProvideConnection() (*Connection, error) {
+	if c.dials.chance(c.DialFailureRate) {
+		return nil, ErrInjectedDialFailure
+	}
+
+	return c.wrap(c.Provider).ProvideConnection()
+}
+
+// wrap returns a copy of provider whose connections go through chaosConn.
+func (c *ChaosConnectionProvider) wrap(provider ConnectionProvider) ConnectionProvider {
+	switch provider := provider.(type) {
+	case *ConnectionInfo:
+		info := *provider
+		dial := provider.dialer()
+
+		info.Dial = func(network, address string) (net.Conn, error) {
+			conn, err := dial(network, address)
+			if err != nil {
+				return nil, err
+			}
+
+			return &chaosConn{
+				Conn:   conn,
+				chaos:  c,
+				reads:  newChaosRandom(c.dials.int63()),
+				writes: newChaosRandom(c.dials.int63()),
+
+				handshakeDelay: &sync.Once{},
+			}, nil
+		}
+
+		return &info
+
+	case *ConnectionCluster:
+		cluster := &ConnectionCluster{}
+		for _, member := range provider.Members {
+			cluster.Members = append(cluster.Members, c.wrap(member))
+		}
+
+		return cluster
+
+	default:
+		return provider
+	}
+}
+
+// connectionInfos returns the members of the wrapped provider with the
+// faults injected into their dials, for the nats.go backend, which dials
+// the members itself instead of calling ProvideConnection.
+func (c *ChaosConnectionProvider) connectionInfos() ([]*ConnectionInfo, error) {
+	infos, err := connectionInfos(c.wrap(c.Provider))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		dial := info.dialer()
+
+		info.Dial = func(network, address string) (net.Conn, error) {
+			if c.dials.chance(c.DialFailureRate) {
+				return nil, ErrInjectedDialFailure
+			}
+
+			return dial(network, address)
+		}
+	}
+
+	return infos, nil
+}
+
+type chaosRandom struct {
+	random *rand.Rand
+	lock   *sync.Mutex
+}
+
+func newChaosRandom(seed int64) *chaosRandom {
+	return &chaosRandom{
+		random: rand.New(rand.NewSource(seed)),
+		lock:   &sync.Mutex{},
+	}
+}
+
+func (r *chaosRandom) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.random.Float64() < rate
+}
+
+func (r *chaosRandom) intn(n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.random.Intn(n)
+}
+
+func (r *chaosRandom) int63() int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.random.Int63()
+}
+
+type chaosConn struct {
+	net.Conn
+	chaos *ChaosConnectionProvider
+
+	reads  *chaosRandom
+	writes *chaosRandom
+
+	handshakeDelay *sync.Once
+}
+
+func (c *chaosConn) Read(b []byte) (int, error) {
+	c.handshakeDelay.Do(func() {
+		if c.chaos.HandshakeDelay > 0 {
+			time.Sleep(c.chaos.HandshakeDelay)
+		}
+	})
+
+	if c.chaos.ReadLatency > 0 {
+		time.Sleep(c.chaos.ReadLatency)
+	}
+
+	if c.reads.chance(c.chaos.DisconnectRate) {
+		c.Conn.Close()
+		return 0, ErrInjectedDisconnect
+	}
+
+	n, err := c.Conn.Read(b)
+
+	if n > 0 && c.reads.chance(c.chaos.CorruptionRate) {
+		b[c.reads.intn(n)] ^= 0xff
+	}
+
+	return n, err
+}
+
+func (c *chaosConn) Write(b []byte) (int, error) {
+	if c.chaos.WriteLatency > 0 {
+		time.Sleep(c.chaos.WriteLatency)
+	}
+
+	if c.writes.chance(c.chaos.DisconnectRate) {
+		c.Conn.Close()
+		return 0, ErrInjectedDisconnect
+	}
+
+	if len(b) > 0 && c.writes.chance(c.chaos.CorruptionRate) {
+		corrupted := make([]byte, len(b))
+		copy(corrupted, b)
+		corrupted[c.writes.intn(len(b))] ^= 0xff
+		b = corrupted
+	}
+
+	if len(b) > 1 && c.writes.chance(c.chaos.PartialWriteRate) {
+		n, err := c.Conn.Write(b[:1+c.writes.intn(len(b)-1)])
+		c.Conn.Close()
+
+		if err == nil {
+			err = io.ErrShortWrite
+		}
+
+		return n, err
+	}
+
+	return c.Conn.Write(b)
+}
@@ -0,0 +1,163 @@
+package yagnats
+
+import (
+	"io"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *YSuite) TestChaosDialFailuresAreReproducible(c *C) {
+	outcomes := func() []bool {
+		chaos := NewChaosConnectionProvider(&FakeConnectionProvider{ReadBuffer: "+OK\r\n"}, 42)
+		chaos.DialFailureRate = 0.5
+
+		failed := []bool{}
+		for i := 0; i < 20; i++ {
+			_, err := chaos.ProvideConnection()
+			failed = append(failed, err == ErrInjectedDialFailure)
+		}
+
+		return failed
+	}
+
+	first := outcomes()
+	c.Assert(outcomes(), DeepEquals, first)
+	c.Assert(first, Not(DeepEquals), make([]bool, 20))
+}
+
+func (s *YSuite) TestChaosWriteFaultsDoNotDependOnReads(c *C) {
+	written := func(interleaveReads bool) []string {
+		clientSide, serverSide := net.Pipe()
+		defer serverSide.Close()
+
+		chaos := NewChaosConnectionProvider(&ConnectionInfo{
+			Addr: "127.0.0.1:4222",
+			Dial: func(network, address string) (net.Conn, error) {
+				return clientSide, nil
+			},
+		}, 42)
+		chaos.CorruptionRate = 0.5
+
+		conn, err := chaos.wrap(chaos.Provider).(*ConnectionInfo).Dial("tcp", "127.0.0.1:4222")
+		c.Assert(err, IsNil)
+		defer conn.Close()
+
+		go io.Copy(serverSide, serverSide)
+
+		received := []string{}
+		for i := 0; i < 20; i++ {
+			if interleaveReads {
+				go serverSide.Write([]byte("x"))
+				conn.Read(make([]byte, 1))
+			}
+
+			conn.Write([]byte("abcd"))
+
+			echoed := make([]byte, 4)
+			_, err := io.ReadFull(conn.(*chaosConn).Conn, echoed)
+			c.Assert(err, IsNil)
+
+			received = append(received, string(echoed))
+		}
+
+		return received
+	}
+
+	c.Assert(written(true), DeepEquals, written(false))
+}
+
+func (s *YSuite) TestChaosHandshakeDelayHoldsUpTheFirstRead(c *C) {
+	chaos := NewChaosConnectionProvider(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+	}, 1)
+	chaos.HandshakeDelay = 200 * time.Millisecond
+
+	start := time.Now()
+
+	conn, err := chaos.ProvideConnection()
+	c.Assert(err, IsNil)
+	defer conn.Disconnect()
+
+	c.Assert(time.Since(start) >= 200*time.Millisecond, Equals, true)
+
+	start = time.Now()
+	c.Assert(conn.Ping(), Equals, true)
+	c.Assert(time.Since(start) < 200*time.Millisecond, Equals, true)
+}
+
+func (s *YSuite) TestChaosDisconnectFailsTheHandshake(c *C) {
+	chaos := NewChaosConnectionProvider(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+	}, 1)
+	chaos.DisconnectRate = 1
+
+	_, err := chaos.ProvideConnection()
+	c.Assert(err, Equals, ErrInjectedDisconnect)
+}
+
+func (s *YSuite) TestChaosPartialWriteFailsTheHandshake(c *C) {
+	chaos := NewChaosConnectionProvider(&ConnectionCluster{
+		[]ConnectionProvider{
+			&ConnectionInfo{Addr: "127.0.0.1:4223", Username: "nats", Password: "nats"},
+		},
+	}, 1)
+	chaos.PartialWriteRate = 1
+
+	_, err := chaos.ProvideConnection()
+	c.Assert(err, Equals, io.ErrShortWrite)
+}
+
+func (s *YSuite) TestChaosClientResubscribesAfterInjectedDisconnects(c *C) {
+	chaos := NewChaosConnectionProvider(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+	}, 7)
+	chaos.DisconnectRate = 0.05
+
+	client := s.newClient()
+
+	var err error
+	for i := 0; i < 20; i++ {
+		err = client.Connect(chaos)
+		if err == nil {
+			break
+		}
+	}
+	c.Assert(err, IsNil)
+
+	received := make(chan bool, 100)
+
+	for i := 0; i < 20; i++ {
+		_, err = client.Subscribe("chaos.subject", func(msg *Message) {
+			received <- true
+		})
+		if err == nil {
+			break
+		}
+	}
+	c.Assert(err, IsNil)
+
+	count := 0
+	deadline := time.Now().Add(10 * time.Second)
+
+	for count < 10 || reconnects(client) == 0 {
+		c.Assert(time.Now().Before(deadline), Equals, true)
+
+		s.NatsConn.Publish("chaos.subject", []byte("hello"))
+
+		select {
+		case <-received:
+			count++
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	client.Disconnect()
+}
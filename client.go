@@ -1,10 +1,17 @@
 package yagnats
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const DefaultPingInterval = 2 * time.Minute
+
+var ErrNotConnected = errors.New("not connected")
+
 type NATSClient interface {
 	Ping() bool
 	Connect(connectionProvider ConnectionProvider) error
@@ -21,27 +28,85 @@ type NATSClient interface {
 type Callback func(*Message)
 
 type Client struct {
+	// accessed atomically; kept first for 64-bit alignment
+	inMsgs     uint64
+	outMsgs    uint64
+	inBytes    uint64
+	outBytes   uint64
+	reconnects uint64
+
 	connection          chan *Connection
 	subscriptions       map[int64]*Subscription
 	subscriptionCounter int64
 	connected           bool
+	connecting          bool
+	reconnecting        bool
 	disconnecting       bool
+	lastError           error
+	provider            ConnectionProvider
 	lock                *sync.Mutex
 
+	publishMiddleware  []PublishMiddleware
+	callbackMiddleware []CallbackMiddleware
+
 	beforeConnectCallback func()
 	ConnectedCallback     func()
+	DisconnectedCallback  func()
+
+	// LameDuckCallback is called when the server announces that it is
+	// entering lame duck mode and will soon close the connection.
+	LameDuckCallback func()
+
+	// MigrateOnLameDuck makes the client move to a new connection from its
+	// ConnectionProvider as soon as the server enters lame duck mode, rather
+	// than waiting to be disconnected. Subscriptions are moved to the new
+	// connection before they are removed from the old one, so callbacks may
+	// briefly see a message twice but never miss one.
+	MigrateOnLameDuck bool
+
+	// PingInterval controls how often the keepalive loop measures the round
+	// trip to the server. A zero or negative interval disables it.
+	PingInterval time.Duration
+	rtts         *rttWindow
+
+	// PendingLimit caps the number of callbacks a subscription may have
+	// running at once; further messages are dropped. Zero means no limit.
+	PendingLimit int
 
 	logger      Logger
+	redactor    *Redactor
 	loggerMutex *sync.RWMutex
 }
 
 type Message struct {
 	Subject string
 	ReplyTo string
+	Header  Header
 	Payload []byte
+
+	ctx context.Context
+}
+
+func (m *Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+
+	return m.ctx
+}
+
+func (m *Message) WithContext(ctx context.Context) *Message {
+	copied := *m
+	copied.ctx = ctx
+	return &copied
 }
 
 type Subscription struct {
+	// accessed atomically; kept first for 64-bit alignment
+	delivered uint64
+	dropped   uint64
+	pending   int64
+
 	Subject  string
 	Queue    string
 	Callback Callback
@@ -54,32 +119,63 @@ func NewClient() *Client {
 		subscriptions: make(map[int64]*Subscription),
 		lock:          &sync.Mutex{},
 
+		PingInterval: DefaultPingInterval,
+		rtts:         newRTTWindow(),
+
 		logger:      &DefaultLogger{},
+		redactor:    NewRedactor(),
 		loggerMutex: &sync.RWMutex{},
 		connected:   false,
 	}
 }
 
 func (c *Client) Ping() bool {
+	_, err := c.RTT()
+	return err == nil
+}
+
+func (c *Client) RTT() (time.Duration, error) {
 	select {
 	case conn := <-c.connection:
-		return conn.Ping()
+		rtt, err := conn.RTT()
+		if err != nil {
+			return 0, err
+		}
+
+		c.rtts.record(rtt)
+
+		return rtt, nil
 	case <-time.After(500 * time.Millisecond):
-		return false
+		return 0, ErrNotConnected
 	}
 }
 
+func (c *Client) RTTHistogram() RTTHistogram {
+	return c.rtts.histogram()
+}
+
 func (c *Client) Connect(cp ConnectionProvider) error {
+	c.lock.Lock()
+	c.connecting = true
+	c.lock.Unlock()
+
 	conn, err := c.connect(cp)
+
+	c.lock.Lock()
+	c.connecting = false
+	if err == nil {
+		c.connected = true
+		c.provider = cp
+	}
+	c.lock.Unlock()
+
 	if err != nil {
 		return err
 	}
 
 	go c.serveConnections(conn, cp)
 
-	if c.ConnectedCallback != nil {
-		go c.ConnectedCallback()
-	}
+	c.fire(&c.ConnectedCallback)
 
 	return nil
 }
@@ -111,30 +207,31 @@ func (c *Client) BeforeConnectCallback(callback func()) {
 }
 
 func (c *Client) Publish(subject string, payload []byte) error {
-	conn := <-c.connection
-
-	conn.Send(
-		&PubPacket{
-			Subject: subject,
-			Payload: payload,
-		},
-	)
-
-	return conn.ErrOrOK()
+	return c.PublishWithReplyTo(subject, "", payload)
 }
 
 func (c *Client) PublishWithReplyTo(subject, reply string, payload []byte) error {
-	conn := <-c.connection
-
-	conn.Send(
-		&PubPacket{
+	return c.PublishMsg(
+		&Message{
 			Subject: subject,
 			ReplyTo: reply,
 			Payload: payload,
 		},
 	)
+}
+
+func (c *Client) PublishMsg(msg *Message) error {
+	publish := c.wrapPublish(c.publish)
+	return publish(msg)
+}
 
-	return conn.ErrOrOK()
+func (c *Client) ServerInfo() (ServerInfo, error) {
+	select {
+	case conn := <-c.connection:
+		return conn.ServerInfo(), nil
+	case <-time.After(500 * time.Millisecond):
+		return ServerInfo{}, ErrNotConnected
+	}
 }
 
 func (c *Client) Subscribe(subject string, callback Callback) (int64, error) {
@@ -148,13 +245,21 @@ func (c *Client) SubscribeWithQueue(subject, queue string, callback Callback) (i
 func (c *Client) Unsubscribe(sid int64) error {
 	conn := <-c.connection
 
-	conn.Send(&UnsubPacket{ID: sid})
+	err := conn.Send(&UnsubPacket{ID: sid})
 
 	c.lock.Lock()
 	delete(c.subscriptions, sid)
 	c.lock.Unlock()
 
-	return conn.ErrOrOK()
+	if err == nil {
+		err = conn.ErrOrOK()
+	}
+
+	if err != nil {
+		c.recordError(err)
+	}
+
+	return err
 }
 
 func (c *Client) UnsubscribeAll(subject string) {
@@ -184,6 +289,64 @@ func (c *Client) Logger() Logger {
 	return c.logger
 }
 
+// SetRedactor replaces the redactor packets pass through before they are
+// logged. nil restores the default one from NewRedactor.
+func (c *Client) SetRedactor(redactor *Redactor) {
+	if redactor == nil {
+		redactor = NewRedactor()
+	}
+
+	c.loggerMutex.Lock()
+	c.redactor = redactor
+	c.loggerMutex.Unlock()
+}
+
+func (c *Client) Redactor() *Redactor {
+	c.loggerMutex.RLock()
+	defer c.loggerMutex.RUnlock()
+	return c.redactor
+}
+
+func (c *Client) publish(msg *Message) error {
+	conn := <-c.connection
+
+	header, payload := msg.Header, msg.Payload
+
+	if len(header) > 0 && !conn.ServerInfo().Headers {
+		fold, ok := headerFallback(msg.Context())
+		if !ok {
+			c.recordError(ErrHeadersNotSupported)
+			return ErrHeadersNotSupported
+		}
+
+		header, payload = nil, fold(header, payload)
+	}
+
+	err := conn.Send(
+		&PubPacket{
+			Subject: msg.Subject,
+			ReplyTo: msg.ReplyTo,
+			Header:  header,
+			Payload: payload,
+		},
+	)
+	if err != nil {
+		c.recordError(err)
+		return err
+	}
+
+	err = conn.ErrOrOK()
+	if err != nil {
+		c.recordError(err)
+		return err
+	}
+
+	atomic.AddUint64(&c.outMsgs, 1)
+	atomic.AddUint64(&c.outBytes, uint64(len(payload)))
+
+	return nil
+}
+
 func (c *Client) subscribe(subject, queue string, callback Callback) (int64, error) {
 	conn := <-c.connection
 
@@ -199,16 +362,21 @@ func (c *Client) subscribe(subject, queue string, callback Callback) (int64, err
 	}
 	c.lock.Unlock()
 
-	conn.Send(
+	err := conn.Send(
 		&SubPacket{
 			Subject: subject,
 			Queue:   queue,
 			ID:      id,
 		},
 	)
+	if err != nil {
+		c.recordError(err)
+		return -1, err
+	}
 
-	err := conn.ErrOrOK()
+	err = conn.ErrOrOK()
 	if err != nil {
+		c.recordError(err)
 		return -1, err
 	}
 
@@ -218,8 +386,12 @@ func (c *Client) subscribe(subject, queue string, callback Callback) (int64, err
 func (c *Client) serveConnections(conn *Connection, cp ConnectionProvider) {
 	c.lock.Lock()
 	c.connected = true
+	c.reconnecting = false
 	c.lock.Unlock()
 
+	stopKeepAlive := make(chan struct{})
+	go c.keepAlive(conn, stopKeepAlive)
+
 	// serve connection until disconnected
 	for stop := false; !stop; {
 		select {
@@ -227,15 +399,31 @@ func (c *Client) serveConnections(conn *Connection, cp ConnectionProvider) {
 			c.Logger().Warn("client.connection.disconnected")
 			stop = true
 
+			c.fire(&c.DisconnectedCallback)
+
+		case <-conn.retired:
+			c.Logger().Info("client.connection.retired")
+			stop = true
+
 		case c.connection <- conn:
 			c.Logger().Debug("client.connection.served")
 		}
 	}
 
+	close(stopKeepAlive)
+
 	c.lock.Lock()
 	disconnecting := c.disconnecting
+	replaced := conn.replaced
+	conn.replaced = true
+	c.reconnecting = !replaced && !disconnecting
 	c.lock.Unlock()
 
+	// a migration has already replaced, or is replacing, the connection
+	if replaced {
+		return
+	}
+
 	// stop if client was told to disconnect
 	if disconnecting {
 		c.Logger().Info("client.disconnecting")
@@ -245,6 +433,45 @@ func (c *Client) serveConnections(conn *Connection, cp ConnectionProvider) {
 	c.reconnect(cp)
 }
 
+// fire runs a callback on its own goroutine. Callbacks are read under the
+// lock because NATSConnFromClient may replace them at any time.
+func (c *Client) fire(callback *func()) {
+	c.lock.Lock()
+	cb := *callback
+	c.lock.Unlock()
+
+	if cb != nil {
+		go cb()
+	}
+}
+
+func (c *Client) keepAlive(conn *Connection, stop chan struct{}) {
+	if c.PingInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			rtt, err := conn.RTT()
+			if err != nil {
+				c.recordError(err)
+				c.Logger().Warnd(map[string]interface{}{"error": err.Error()}, "client.keepalive.ping-failed")
+				continue
+			}
+
+			c.rtts.record(rtt)
+			c.Logger().Debugd(map[string]interface{}{"rtt": rtt.String()}, "client.keepalive.pong-received")
+		}
+	}
+}
+
 func (c *Client) connect(cp ConnectionProvider) (conn *Connection, err error) {
 	if c.beforeConnectCallback != nil {
 		c.beforeConnectCallback()
@@ -256,8 +483,10 @@ func (c *Client) connect(cp ConnectionProvider) (conn *Connection, err error) {
 	}
 
 	conn.OnMessage(c.dispatchMessage)
+	conn.OnLameDuck(func() { c.lameDuck(conn, cp) })
 
 	conn.SetLogger(c.Logger())
+	conn.SetRedactor(c.Redactor())
 
 	return
 }
@@ -269,23 +498,97 @@ func (c *Client) reconnect(cp ConnectionProvider) {
 
 		conn, err := c.connect(cp)
 		if err == nil {
+			atomic.AddUint64(&c.reconnects, 1)
+
 			go c.serveConnections(conn, cp)
 			c.Logger().Debug("client.connection.resubscribing")
 			c.resubscribe(conn)
 			c.Logger().Debug("client.connection.resubscribed")
 
-			if c.ConnectedCallback != nil {
-				go c.ConnectedCallback()
-			}
+			c.fire(&c.ConnectedCallback)
 			break
 		}
 
+		c.recordError(err)
 		c.Logger().Warnd(map[string]interface{}{"error": err.Error()}, "client.reconnect.failed")
 
 		time.Sleep(500 * time.Millisecond)
 	}
 }
 
+func (c *Client) lameDuck(conn *Connection, cp ConnectionProvider) {
+	c.Logger().Warn("client.connection.lame-duck")
+
+	c.fire(&c.LameDuckCallback)
+
+	if c.MigrateOnLameDuck {
+		go c.migrate(conn, cp)
+	}
+}
+
+func (c *Client) migrate(old *Connection, cp ConnectionProvider) {
+	c.Logger().Info("client.lame-duck.migrating")
+
+	// a server in lame duck mode refuses new connections, so a cluster
+	// provider hands out one of its other members
+	conn, err := c.connect(cp)
+	if err != nil {
+		c.recordError(err)
+		c.Logger().Warnd(map[string]interface{}{"error": err.Error()}, "client.lame-duck.migrate-failed")
+		return
+	}
+
+	err = c.resubscribe(conn)
+	if err != nil {
+		conn.Disconnect()
+		c.recordError(err)
+		c.Logger().Warnd(map[string]interface{}{"error": err.Error()}, "client.lame-duck.migrate-failed")
+		return
+	}
+
+	c.lock.Lock()
+	disconnecting := c.disconnecting
+	replaced := old.replaced
+	old.replaced = true
+	ids := make([]int64, 0, len(c.subscriptions))
+	for id := range c.subscriptions {
+		ids = append(ids, id)
+	}
+	c.lock.Unlock()
+
+	// the old connection dropped in the meantime and is being reconnected
+	if disconnecting || replaced {
+		conn.Disconnect()
+		return
+	}
+
+	atomic.AddUint64(&c.reconnects, 1)
+
+	go c.serveConnections(conn, cp)
+	old.retire()
+
+	// drain the old connection; anything already in flight on it
+	// completes before it is closed
+	for _, id := range ids {
+		err := old.Send(&UnsubPacket{ID: id})
+		if err == nil {
+			err = old.ErrOrOK()
+		}
+
+		if err != nil {
+			c.Logger().Warnd(map[string]interface{}{"error": err.Error()}, "client.lame-duck.unsubscribe-failed")
+			break
+		}
+	}
+
+	old.RTT()
+	old.Disconnect()
+
+	c.Logger().Info("client.lame-duck.migrated")
+
+	c.fire(&c.ConnectedCallback)
+}
+
 func (c *Client) resubscribe(conn *Connection) error {
 	packetsToSend := []*SubPacket{}
 
@@ -301,9 +604,12 @@ func (c *Client) resubscribe(conn *Connection) error {
 	c.lock.Unlock()
 
 	for _, packet := range packetsToSend {
-		conn.Send(packet)
+		err := conn.Send(packet)
+		if err != nil {
+			return err
+		}
 
-		err := conn.ErrOrOK()
+		err = conn.ErrOrOK()
 		if err != nil {
 			return err
 		}
@@ -321,11 +627,31 @@ func (c *Client) dispatchMessage(msg *MsgPacket) {
 	}
 	c.lock.Unlock()
 
-	go sub.Callback(
-		&Message{
-			Subject: msg.Subject,
-			Payload: msg.Payload,
-			ReplyTo: msg.ReplyTo,
-		},
-	)
+	atomic.AddUint64(&c.inMsgs, 1)
+	atomic.AddUint64(&c.inBytes, uint64(len(msg.Payload)))
+
+	if c.PendingLimit > 0 && atomic.LoadInt64(&sub.pending) >= int64(c.PendingLimit) {
+		atomic.AddUint64(&sub.dropped, 1)
+		c.Logger().Warnd(map[string]interface{}{"subject": sub.Subject, "sid": sub.ID}, "client.subscription.slow-consumer")
+		return
+	}
+
+	atomic.AddInt64(&sub.pending, 1)
+
+	callback := c.wrapCallback(sub.Callback)
+
+	go func() {
+		defer atomic.AddInt64(&sub.pending, -1)
+
+		atomic.AddUint64(&sub.delivered, 1)
+
+		callback(
+			&Message{
+				Subject: msg.Subject,
+				Payload: msg.Payload,
+				ReplyTo: msg.ReplyTo,
+				Header:  msg.Header,
+			},
+		)
+	}()
 }
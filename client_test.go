@@ -1,37 +1,46 @@
 package yagnats
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"net"
-	"os/exec"
-	"strings"
+	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/nats-io/nats-server/v2/server"
 	. "gopkg.in/check.v1"
 )
 
 func Test(t *testing.T) { TestingT(t) }
 
+// YSuite runs against Client and against NewClientWithNATSGo. Tests of
+// behaviour only Client has go through legacyClient.
 type YSuite struct {
-	Client   *Client
-	NatsConn NATSConn
-	NatsCmd  *exec.Cmd
+	newClient func() NATSClient
+
+	Client     NATSClient
+	NatsConn   NATSConn
+	NatsServer *server.Server
 }
 
-var _ = Suite(&YSuite{})
+var _ = Suite(&YSuite{newClient: func() NATSClient { return NewClient() }})
+var _ = Suite(&YSuite{newClient: NewClientWithNATSGo})
 
 func (s *YSuite) SetUpSuite(c *C) {
-	s.NatsCmd = startNats(4223)
+	s.NatsServer = startNats(4223)
 	waitUntilNatsUp(4223)
 }
 
 func (s *YSuite) TearDownSuite(c *C) {
-	stopCmd(s.NatsCmd)
+	stopNats(s.NatsServer)
 }
 
 func (s *YSuite) SetUpTest(c *C) {
-	client := NewClient()
+	client := s.newClient()
 
 	client.Connect(&ConnectionInfo{
 		Addr:     "127.0.0.1:4223",
@@ -55,13 +64,39 @@ func (s *YSuite) TearDownTest(c *C) {
 	s.NatsConn = nil
 }
 
+// legacyOnly skips the test when the suite runs against another backend.
+func (s *YSuite) legacyOnly(c *C) {
+	if _, ok := s.Client.(*Client); !ok {
+		c.Skip("exercises Client")
+	}
+}
+
+// legacyClient returns the suite's client, skipping the test when the suite
+// runs against another backend.
+func (s *YSuite) legacyClient(c *C) *Client {
+	s.legacyOnly(c)
+	return s.Client.(*Client)
+}
+
+// reconnects returns how often client has reconnected.
+func reconnects(client NATSClient) uint64 {
+	switch client := client.(type) {
+	case *Client:
+		return client.Statistics().Reconnects
+	case *natsGoClient:
+		return client.connection().(*apceraNATSWrapper).Stats().Reconnects
+	default:
+		return 0
+	}
+}
+
 func (s *YSuite) TestDisconnectOnNewClient(c *C) {
-	client := NewClient()
+	client := s.newClient()
 	client.Disconnect()
 }
 
 func (s *YSuite) TestConnectWithInvalidAddress(c *C) {
-	badClient := NewClient()
+	badClient := s.newClient()
 
 	err := badClient.Connect(&ConnectionInfo{Addr: ""})
 
@@ -70,7 +105,7 @@ func (s *YSuite) TestConnectWithInvalidAddress(c *C) {
 }
 
 func (s *YSuite) TestClientConnectWithInvalidAuth(c *C) {
-	badClient := NewClient()
+	badClient := s.newClient()
 
 	err := badClient.Connect(&ConnectionInfo{
 		Addr:     "127.0.0.1:4223",
@@ -85,7 +120,7 @@ func (s *YSuite) TestConnectWithCustomDial(c *C) {
 	var dialTargetNetwork string
 	var dialTargetAddress string
 
-	client := NewClient()
+	client := s.newClient()
 	defer client.Disconnect()
 
 	client.Connect(&ConnectionInfo{
@@ -100,17 +135,106 @@ func (s *YSuite) TestConnectWithCustomDial(c *C) {
 		},
 	})
 
-	c.Assert(s.Client.Ping(), Equals, true)
+	c.Assert(client.Ping(), Equals, true)
 	c.Assert(dialTargetNetwork, Equals, "tcp")
 	c.Assert(dialTargetAddress, Equals, "127.0.0.1:9999")
 }
 
+func (s *YSuite) TestConnectOverUnixSocket(c *C) {
+	s.legacyOnly(c)
+
+	path := filepath.Join(c.MkDir(), "nats.sock")
+
+	listener, err := net.Listen("unix", path)
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go relay(conn, "127.0.0.1:4223")
+		}
+	}()
+
+	client := NewClient()
+	defer client.Disconnect()
+
+	err = client.Connect(&ConnectionInfo{
+		Network:  "unix",
+		Addr:     path,
+		Username: "nats",
+		Password: "nats",
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(client.Ping(), Equals, true)
+}
+
+func (s *YSuite) TestConnectWithCustomDialer(c *C) {
+	controlled := false
+
+	client := s.newClient()
+	defer client.Disconnect()
+
+	err := client.Connect(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+		Dialer: &net.Dialer{
+			Control: func(network, address string, conn syscall.RawConn) error {
+				controlled = true
+				return nil
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(controlled, Equals, true)
+	c.Assert(client.Ping(), Equals, true)
+}
+
+func (s *YSuite) TestConnectWithDialTimeout(c *C) {
+	client := s.newClient()
+
+	err := client.Connect(&ConnectionInfo{
+		Addr:        "127.0.0.1:4223",
+		Username:    "nats",
+		Password:    "nats",
+		DialTimeout: 50 * time.Millisecond,
+		Dialer: &net.Dialer{
+			Control: func(network, address string, conn syscall.RawConn) error {
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			},
+		},
+	})
+	c.Assert(err, NotNil)
+	c.Assert(err, ErrorMatches, ".*i/o timeout")
+}
+
+func relay(conn net.Conn, addr string) {
+	defer conn.Close()
+
+	upstream, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
 func (s *YSuite) TestClientPing(c *C) {
 	c.Assert(s.Client.Ping(), Equals, true)
 }
 
 func (s *YSuite) TestClientPingWhenNotConnected(c *C) {
-	disconnectedClient := NewClient()
+	disconnectedClient := s.newClient()
 	c.Assert(disconnectedClient.Ping(), Equals, false)
 }
 
@@ -121,6 +245,8 @@ func (s *YSuite) TestClientPingWhenConnectionClosed(c *C) {
 }
 
 func (s *YSuite) TestClientPingWhenResponseIsTooSlow(c *C) {
+	s.legacyOnly(c)
+
 	fakeConn := NewConnection("127.0.0.1:4223", "nats", "nats")
 
 	conn, err := net.Dial("tcp", "127.0.0.1:4223")
@@ -140,12 +266,211 @@ func (s *YSuite) TestClientPingWhenResponseIsTooSlow(c *C) {
 
 	go func() {
 		time.Sleep(1 * time.Second)
-		fakeConn.pongs <- &PongPacket{}
+		fakeConn.receivedPong()
 	}()
 
 	c.Assert(disconnectedClient.Ping(), Equals, false)
 }
 
+func (s *YSuite) TestClientRTT(c *C) {
+	client := s.legacyClient(c)
+
+	rtt, err := client.RTT()
+	c.Assert(err, IsNil)
+	c.Assert(rtt > 0, Equals, true)
+
+	histogram := client.RTTHistogram()
+	c.Assert(histogram.Count, Equals, 1)
+	c.Assert(histogram.Last, Equals, rtt)
+}
+
+func (s *YSuite) TestClientRTTWhenNotConnected(c *C) {
+	s.legacyOnly(c)
+
+	disconnectedClient := NewClient()
+
+	_, err := disconnectedClient.RTT()
+	c.Assert(err, Equals, ErrNotConnected)
+}
+
+func (s *YSuite) TestClientKeepAliveRecordsRTT(c *C) {
+	s.legacyOnly(c)
+
+	client := NewClient()
+	client.PingInterval = 50 * time.Millisecond
+
+	err := client.Connect(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	time.Sleep(300 * time.Millisecond)
+
+	histogram := client.RTTHistogram()
+	c.Assert(histogram.Count >= 3, Equals, true)
+	c.Assert(histogram.Min <= histogram.Mean, Equals, true)
+	c.Assert(histogram.Mean <= histogram.Max, Equals, true)
+
+	total := 0
+	for _, bucket := range histogram.Buckets {
+		total += bucket.Count
+	}
+	c.Assert(total, Equals, histogram.Count)
+}
+
+func (s *YSuite) TestClientStatistics(c *C) {
+	client := s.legacyClient(c)
+
+	payload := make(chan []byte)
+
+	sid, _ := client.Subscribe("some.subject", func(msg *Message) {
+		payload <- msg.Payload
+	})
+
+	client.Publish("some.subject", []byte("hello!"))
+	client.PublishWithReplyTo("some.other.subject", "some.reply", []byte("hi"))
+
+	waitReceive(c, "hello!", payload, 500)
+
+	stats := client.Statistics()
+	c.Assert(stats.OutMsgs, Equals, uint64(2))
+	c.Assert(stats.OutBytes, Equals, uint64(8))
+	c.Assert(stats.InMsgs, Equals, uint64(1))
+	c.Assert(stats.InBytes, Equals, uint64(6))
+	c.Assert(stats.Reconnects, Equals, uint64(0))
+	c.Assert(stats.LastError, IsNil)
+
+	c.Assert(stats.Subscriptions, HasLen, 1)
+	c.Assert(stats.Subscriptions[0].ID, Equals, sid)
+	c.Assert(stats.Subscriptions[0].Subject, Equals, "some.subject")
+	c.Assert(stats.Subscriptions[0].Delivered, Equals, uint64(1))
+	c.Assert(stats.Subscriptions[0].Dropped, Equals, uint64(0))
+}
+
+func (s *YSuite) TestClientStatisticsIgnoresUnknownSubscriptions(c *C) {
+	client := s.legacyClient(c)
+
+	client.dispatchMessage(&MsgPacket{SubID: 42, Subject: "some.subject", Payload: []byte("hello!")})
+
+	stats := client.Statistics()
+	c.Assert(stats.InMsgs, Equals, uint64(0))
+	c.Assert(stats.InBytes, Equals, uint64(0))
+}
+
+func (s *YSuite) TestClientMigrateBacksOffWhenConnectionWasReplaced(c *C) {
+	client := s.legacyClient(c)
+
+	conn := <-client.connection
+
+	// as serveConnections does when the connection drops first
+	client.lock.Lock()
+	conn.replaced = true
+	client.lock.Unlock()
+
+	client.migrate(conn, &ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+	})
+
+	c.Assert(client.Statistics().Reconnects, Equals, uint64(0))
+	c.Assert(<-client.connection, Equals, conn)
+}
+
+func (s *YSuite) TestClientStatisticsLastError(c *C) {
+	client := s.legacyClient(c)
+
+	client.Subscribe(">.a", func(msg *Message) {})
+
+	stats := client.Statistics()
+	c.Assert(stats.LastError, ErrorMatches, "Invalid Subject")
+}
+
+func (s *YSuite) TestClientPendingLimitDropsMessages(c *C) {
+	client := s.legacyClient(c)
+
+	client.PendingLimit = 1
+
+	block := make(chan bool)
+	defer close(block)
+
+	received := make(chan []byte, 3)
+
+	client.Subscribe("some.subject", func(msg *Message) {
+		received <- msg.Payload
+		<-block
+	})
+
+	client.Publish("some.subject", []byte("one"))
+	waitReceive(c, "one", received, 500)
+
+	client.Publish("some.subject", []byte("two"))
+	client.Publish("some.subject", []byte("three"))
+	c.Assert(client.Ping(), Equals, true)
+
+	stats := client.Statistics()
+	c.Assert(stats.InMsgs, Equals, uint64(3))
+	c.Assert(stats.Subscriptions[0].Delivered, Equals, uint64(1))
+	c.Assert(stats.Subscriptions[0].Dropped, Equals, uint64(2))
+	c.Assert(stats.Subscriptions[0].Pending, Equals, int64(1))
+}
+
+func (s *YSuite) TestClientPublishMiddleware(c *C) {
+	client := s.legacyClient(c)
+
+	payload := make(chan []byte)
+	calls := []string{}
+
+	client.AddPublishMiddleware(func(next PublishFunc) PublishFunc {
+		return func(msg *Message) error {
+			calls = append(calls, "first")
+			msg.Payload = append([]byte("wrapped "), msg.Payload...)
+			return next(msg)
+		}
+	})
+
+	client.AddPublishMiddleware(func(next PublishFunc) PublishFunc {
+		return func(msg *Message) error {
+			calls = append(calls, "second")
+			return next(msg)
+		}
+	})
+
+	client.Subscribe("some.subject", func(msg *Message) {
+		payload <- msg.Payload
+	})
+
+	err := client.Publish("some.subject", []byte("hello!"))
+	c.Assert(err, IsNil)
+
+	waitReceive(c, "wrapped hello!", payload, 500)
+	c.Assert(calls, DeepEquals, []string{"first", "second"})
+}
+
+func (s *YSuite) TestClientCallbackMiddleware(c *C) {
+	client := s.legacyClient(c)
+
+	payload := make(chan []byte)
+
+	client.AddCallbackMiddleware(func(next Callback) Callback {
+		return func(msg *Message) {
+			msg.Payload = append([]byte("wrapped "), msg.Payload...)
+			next(msg)
+		}
+	})
+
+	client.Subscribe("some.subject", func(msg *Message) {
+		payload <- msg.Payload
+	})
+
+	client.Publish("some.subject", []byte("hello!"))
+
+	waitReceive(c, "wrapped hello!", payload, 500)
+}
+
 func (s *YSuite) TestClientSubscribe(c *C) {
 	sub, _ := s.Client.Subscribe("some.subject", func(msg *Message) {})
 	c.Assert(sub, Equals, int64(1))
@@ -214,9 +539,9 @@ func (s *YSuite) TestClientSubscribeAndUnsubscribe(c *C) {
 
 func (s *YSuite) TestClientAutoResubscribe(c *C) {
 	doomedNats := startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
-	durableClient := NewClient()
+	durableClient := s.newClient()
 	durableClient.Connect(&ConnectionInfo{
 		Addr:     "127.0.0.1:4213",
 		Username: "nats",
@@ -229,21 +554,27 @@ func (s *YSuite) TestClientAutoResubscribe(c *C) {
 		payload <- msg.Payload
 	})
 
-	stopCmd(doomedNats)
+	stopNats(doomedNats)
 	waitUntilNatsDown(4213)
 	doomedNats = startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	waitUntilNatsUp(4213)
 
 	durableClient.Publish("some.subject", []byte("hello!"))
 
 	waitReceive(c, "hello!", payload, 500)
+
+	c.Assert(reconnects(durableClient), Equals, uint64(1))
+
+	durableClient.Disconnect()
 }
 
 func (s *YSuite) TestClientConnectCallback(c *C) {
+	s.legacyOnly(c)
+
 	doomedNats := startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	connectionChannel := make(chan []byte)
 
@@ -259,11 +590,15 @@ func (s *YSuite) TestClientConnectCallback(c *C) {
 	})
 
 	waitReceive(c, "yo", connectionChannel, 500)
+
+	newClient.Disconnect()
 }
 
 func (s *YSuite) TestClientConnectCallbackOnReconnect(c *C) {
+	s.legacyOnly(c)
+
 	doomedNats := startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	connectionChannel := make(chan []byte)
 
@@ -280,32 +615,46 @@ func (s *YSuite) TestClientConnectCallbackOnReconnect(c *C) {
 
 	waitReceive(c, "yo", connectionChannel, 500)
 
-	stopCmd(doomedNats)
+	stopNats(doomedNats)
 	err := waitUntilNatsDown(4213)
 	c.Assert(err, IsNil)
 
 	doomedNats = startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	waitUntilNatsUp(4213)
 
 	waitReceive(c, "yo", connectionChannel, 500)
+
+	durableClient.Disconnect()
 }
 
 func (s *YSuite) TestClientBeforeConnectCallback(c *C) {
 	doomedNats := startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	channel := make(chan []byte, 1)
 
-	durableClient := NewClient()
+	durableClient := s.newClient()
 
 	durableClient.BeforeConnectCallback(func() {
-		channel <- []byte("before connect callback")
+		// failed dials while the server is down call it again
+		select {
+		case channel <- []byte("before connect callback"):
+		default:
+		}
 	})
 
-	durableClient.ConnectedCallback = func() {
-		channel <- []byte("connected callback")
+	connected := make(chan []byte, 1)
+
+	legacy, isLegacy := durableClient.(*Client)
+	if isLegacy {
+		legacy.ConnectedCallback = func() {
+			select {
+			case connected <- []byte("connected callback"):
+			default:
+			}
+		}
 	}
 
 	durableClient.Connect(&ConnectionInfo{
@@ -315,20 +664,29 @@ func (s *YSuite) TestClientBeforeConnectCallback(c *C) {
 	})
 
 	waitReceive(c, "before connect callback", channel, 500)
-	waitReceive(c, "connected callback", channel, 500)
+	if isLegacy {
+		waitReceive(c, "connected callback", connected, 500)
+	}
 
-	stopCmd(doomedNats)
+	stopNats(doomedNats)
 	err := waitUntilNatsDown(4213)
 	c.Assert(err, IsNil)
 
 	doomedNats = startNats(4213)
-	defer stopCmd(doomedNats)
-	waitReceive(c, "before connect callback", channel, 500)
+	defer stopNats(doomedNats)
+	waitReceive(c, "before connect callback", channel, 1000)
+
+	waitUntilNatsUp(4213)
+	c.Assert(durableClient.Ping(), Equals, true)
+
+	durableClient.Disconnect()
 }
 
 func (s *YSuite) TestClientReconnectCallbackSelfPublish(c *C) {
+	s.legacyOnly(c)
+
 	doomedNats := startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	connectionChannel := make(chan []byte)
 
@@ -354,16 +712,82 @@ func (s *YSuite) TestClientReconnectCallbackSelfPublish(c *C) {
 		connectionChannel <- []byte("yo")
 	})
 
-	stopCmd(doomedNats)
+	stopNats(doomedNats)
 	err := waitUntilNatsDown(4213)
 	c.Assert(err, IsNil)
 
 	doomedNats = startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	waitUntilNatsUp(4213)
 
 	waitReceive(c, "yo", connectionChannel, 500)
+
+	durableClient.Disconnect()
+}
+
+func (s *YSuite) TestClientMigratesOnLameDuck(c *C) {
+	s.legacyOnly(c)
+
+	retiringNats := startNats(4560)
+	defer stopNats(retiringNats)
+
+	otherNats := startNats(4561)
+	defer stopNats(otherNats)
+
+	lameDucks := make(chan bool, 1)
+	received := make(chan []byte, 1)
+
+	client := NewClient()
+	client.MigrateOnLameDuck = true
+	client.LameDuckCallback = func() {
+		lameDucks <- true
+	}
+
+	err := client.Connect(&ConnectionCluster{
+		[]ConnectionProvider{
+			&ConnectionInfo{Addr: "127.0.0.1:4560", Username: "nats", Password: "nats"},
+			&ConnectionInfo{Addr: "127.0.0.1:4561", Username: "nats", Password: "nats"},
+		},
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	_, err = client.Subscribe("some.subject", func(msg *Message) {
+		received <- msg.Payload
+	})
+	c.Assert(err, IsNil)
+
+	lameDuck(retiringNats)
+
+	select {
+	case <-lameDucks:
+	case <-time.After(5 * time.Second):
+		c.Fatal("lame duck callback was not called")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Statistics().Reconnects == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	c.Assert(client.Statistics().Reconnects, Equals, uint64(1))
+
+	publisher := NewClient()
+	err = publisher.Connect(&ConnectionInfo{Addr: "127.0.0.1:4561", Username: "nats", Password: "nats"})
+	c.Assert(err, IsNil)
+	defer publisher.Disconnect()
+
+	info, err := client.ServerInfo()
+	c.Assert(err, IsNil)
+
+	otherInfo, err := publisher.ServerInfo()
+	c.Assert(err, IsNil)
+	c.Assert(info.ServerID, Equals, otherInfo.ServerID)
+
+	err = publisher.Publish("some.subject", []byte("hello"))
+	c.Assert(err, IsNil)
+
+	waitReceive(c, "hello", received, 500)
 }
 
 func (s *YSuite) TestClientSubscribeInvalidSubject(c *C) {
@@ -446,6 +870,90 @@ func (s *YSuite) TestClientPublishWithReply(c *C) {
 	waitReceive(c, "response!", payload, 500)
 }
 
+func (s *YSuite) TestClientPubSubWithHeader(c *C) {
+	client := s.legacyClient(c)
+
+	header := make(chan Header)
+
+	client.Subscribe("some.subject", func(msg *Message) {
+		header <- msg.Header
+	})
+
+	info, err := client.ServerInfo()
+	c.Assert(err, IsNil)
+	c.Assert(info.Headers, Equals, true)
+
+	err = client.PublishMsg(&Message{
+		Subject: "some.subject",
+		Header:  Header{"some-key": {"some-value"}},
+		Payload: []byte("hello!"),
+	})
+	c.Assert(err, IsNil)
+
+	select {
+	case received := <-header:
+		c.Assert(received.Get("some-key"), Equals, "some-value")
+	case <-time.After(500 * time.Millisecond):
+		c.Error("Did not receive message.")
+	}
+}
+
+func (s *YSuite) TestClientFoldsHeadersWithoutServerSupport(c *C) {
+	s.legacyOnly(c)
+
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	published := make(chan string, 1)
+
+	go func() {
+		serverSide.Write([]byte("INFO {\"headers\":false}\r\n"))
+
+		br := bufio.NewReader(serverSide)
+
+		br.ReadString('\n')
+		serverSide.Write([]byte("+OK\r\n"))
+
+		br.ReadString('\n')
+		serverSide.Write([]byte("PONG\r\n"))
+
+		line, _ := br.ReadString('\n')
+		payload, _ := br.ReadString('\n')
+		serverSide.Write([]byte("+OK\r\n"))
+
+		published <- line + payload
+	}()
+
+	client := NewClient()
+	defer client.Disconnect()
+
+	err := client.Connect(&ConnectionInfo{
+		Addr: "127.0.0.1:4222",
+		Dial: func(network, address string) (net.Conn, error) {
+			return clientSide, nil
+		},
+	})
+	c.Assert(err, IsNil)
+
+	msg := &Message{
+		Subject: "some.subject",
+		Header:  Header{"some-key": {"some-value"}},
+		Payload: []byte("hello!"),
+	}
+
+	err = client.PublishMsg(msg)
+	c.Assert(err, Equals, ErrHeadersNotSupported)
+
+	fold := func(header Header, payload []byte) []byte {
+		return append([]byte(header.Get("some-key")+":"), payload...)
+	}
+
+	err = client.PublishMsg(msg.WithContext(WithHeaderFallback(context.Background(), fold)))
+	c.Assert(err, IsNil)
+
+	c.Assert(<-published, Equals, "PUB some.subject 17\r\nsome-value:hello!\r\n")
+}
+
 func (s *YSuite) TestClientDisconnect(c *C) {
 	payload := make(chan []byte)
 
@@ -455,7 +963,7 @@ func (s *YSuite) TestClientDisconnect(c *C) {
 
 	s.Client.Disconnect()
 
-	otherClient := NewClient()
+	otherClient := s.newClient()
 	otherClient.Connect(&ConnectionInfo{
 		Addr:     "127.0.0.1:4223",
 		Username: "nats",
@@ -472,33 +980,39 @@ func (s *YSuite) TestClientDisconnect(c *C) {
 }
 
 func (s *YSuite) TestClientMessageWithoutSubscription(c *C) {
+	client := s.legacyClient(c)
+
 	payload := make(chan []byte)
 
-	sid, err := s.Client.Subscribe("some.subject", func(msg *Message) {
+	sid, err := client.Subscribe("some.subject", func(msg *Message) {
 		payload <- msg.Payload
 	})
 
-	s.Client.Subscribe("some.other.subject", func(msg *Message) {
+	client.Subscribe("some.other.subject", func(msg *Message) {
 		payload <- msg.Payload
 	})
 
 	c.Assert(err, Equals, nil)
 
-	delete(s.Client.subscriptions, sid)
+	delete(client.subscriptions, sid)
 
-	s.Client.Publish("some.subject", []byte("hello!"))
-	s.Client.Publish("some.other.subject", []byte("hello to other!"))
+	client.Publish("some.subject", []byte("hello!"))
+	client.Publish("some.other.subject", []byte("hello to other!"))
 
 	waitReceive(c, "hello to other!", payload, 500)
 }
 
 func (s *YSuite) TestClientLogging(c *C) {
+	client := s.legacyClient(c)
+
 	logger := &DefaultLogger{}
-	s.Client.SetLogger(logger)
-	c.Assert(s.Client.Logger(), Equals, logger)
+	client.SetLogger(logger)
+	c.Assert(client.Logger(), Equals, logger)
 }
 
 func (s *YSuite) TestClientPassesLoggerToConnection(c *C) {
+	s.legacyOnly(c)
+
 	logger := &DefaultLogger{}
 
 	client := NewClient()
@@ -516,6 +1030,8 @@ func (s *YSuite) TestClientPassesLoggerToConnection(c *C) {
 }
 
 func (s *YSuite) TestClientMessageWhileResubscribing(c *C) {
+	s.legacyOnly(c)
+
 	client := NewClient()
 
 	client.Connect(&DisconnectingConnectionProvider{
@@ -542,9 +1058,9 @@ func (s *YSuite) TestClientMessageWhileResubscribing(c *C) {
 
 func (s *YSuite) TestClientPubSubWithQueueReconnectsWithQueue(c *C) {
 	doomedNats := startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
-	durableClient := NewClient()
+	durableClient := s.newClient()
 	durableClient.Connect(&ConnectionInfo{
 		Addr:     "127.0.0.1:4213",
 		Username: "nats",
@@ -571,11 +1087,11 @@ func (s *YSuite) TestClientPubSubWithQueueReconnectsWithQueue(c *C) {
 	case <-time.After(500 * time.Millisecond):
 	}
 
-	stopCmd(doomedNats)
+	stopNats(doomedNats)
 	waitUntilNatsDown(4213)
 
 	doomedNats = startNats(4213)
-	defer stopCmd(doomedNats)
+	defer stopNats(doomedNats)
 
 	waitUntilNatsUp(4213)
 
@@ -588,10 +1104,12 @@ func (s *YSuite) TestClientPubSubWithQueueReconnectsWithQueue(c *C) {
 		c.Error("Should not have received message.")
 	case <-time.After(500 * time.Millisecond):
 	}
+
+	durableClient.Disconnect()
 }
 
 func (s *YSuite) TestClientConnectOverTLSToNonTLSEnabledServer(c *C) {
-	otherClient := NewClient()
+	otherClient := s.newClient()
 	err := otherClient.Connect(&ConnectionInfo{
 		Addr:     "127.0.0.1:4223",
 		Username: "nats",
@@ -600,8 +1118,7 @@ func (s *YSuite) TestClientConnectOverTLSToNonTLSEnabledServer(c *C) {
 		TLSInfo: &ConnectionTLSInfo{},
 	})
 
-	c.Assert(err, NotNil)
-	c.Assert(strings.Contains(err.Error(), "tls: first record does not look like a TLS handshake"), Equals, true)
+	c.Assert(err, Equals, ErrSecureConnWanted)
 }
 
 func waitReceive(c *C, expected string, from chan []byte, ms time.Duration) {
@@ -5,31 +5,77 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"io"
 	"net"
+	"reflect"
 	"sync"
 	"time"
 )
 
+var (
+	ErrDisconnected       = errors.New("disconnected")
+	ErrPingTimeout        = errors.New("ping timed out")
+	ErrOKTimeout          = errors.New("timed out waiting for +OK")
+	ErrNoServerInfo       = errors.New("server did not send INFO")
+	ErrSecureConnRequired = errors.New("server requires TLS but no TLS configuration was given")
+	ErrSecureConnWanted   = errors.New("TLS configured but the server does not offer TLS")
+	ErrServerNameRequired = errors.New("TLS over a unix socket requires a ServerName")
+)
+
+const DefaultDialTimeout = 5 * time.Second
+
+const DefaultWriteTimeout = 2 * time.Second
+
+// setupTimeout bounds reading INFO, the TLS handshake and waiting for the
+// +OK and PONG that complete the handshake.
+const setupTimeout = 5 * time.Second
+
 type Connection struct {
 	conn net.Conn
 
-	addr string
-	user string
-	pass string
+	network string
+	addr    string
+	user    string
+	pass    string
 
 	dial func(network, address string) (net.Conn, error)
 
-	writeLock *sync.Mutex
+	tlsConfig      *tls.Config
+	handshakeFirst bool
+
+	writeLock    *sync.Mutex
+	writeTimeout time.Duration
+
+	pendingPongs []chan time.Time
+	pongLock     *sync.Mutex
 
-	pongs chan *PongPacket
-	oks   chan *OKPacket
-	errs  chan error
+	oks  chan *OKPacket
+	errs chan error
 
-	onMessage func(*MsgPacket)
+	onMessage  func(*MsgPacket)
+	onLameDuck func()
+
+	serverInfo ServerInfo
+	lameDuck   bool
+	infoLock   *sync.RWMutex
 
 	Disconnected chan bool
 
+	// closed by Disconnect so that a +OK nobody waits for any more, such as
+	// one arriving after the handshake timed out, does not block forever
+	closed    chan struct{}
+	closeOnce *sync.Once
+
+	// closed once the client has moved its subscriptions elsewhere
+	retired    chan struct{}
+	retireOnce *sync.Once
+
+	// replaced is set by whichever of a reconnect or a lame duck migration
+	// claims the job of replacing the connection; guarded by the client lock
+	replaced bool
+
 	logger      Logger
+	redactor    *Redactor
 	loggerMutex *sync.RWMutex
 }
 
@@ -39,20 +85,24 @@ type ConnectionProvider interface {
 
 func NewConnection(addr, user, pass string) *Connection {
 	return &Connection{
-		addr: addr,
-		user: user,
-		pass: pass,
+		network: "tcp",
+		addr:    addr,
+		user:    user,
+		pass:    pass,
 
 		dial: func(network, address string) (net.Conn, error) {
-			return net.DialTimeout(network, address, 5*time.Second)
+			return net.DialTimeout(network, address, DefaultDialTimeout)
 		},
 
-		writeLock: &sync.Mutex{},
+		writeLock:    &sync.Mutex{},
+		writeTimeout: DefaultWriteTimeout,
 
 		logger:      &DefaultLogger{},
+		redactor:    NewRedactor(),
 		loggerMutex: &sync.RWMutex{},
 
-		pongs: make(chan *PongPacket),
+		pongLock: &sync.Mutex{},
+		infoLock: &sync.RWMutex{},
 
 		oks: make(chan *OKPacket),
 
@@ -61,73 +111,133 @@ func NewConnection(addr, user, pass string) *Connection {
 		errs: make(chan error, 1),
 
 		Disconnected: make(chan bool),
+
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+
+		retired:    make(chan struct{}),
+		retireOnce: &sync.Once{},
 	}
 }
 
 func NewTLSConnection(addr, user, pass string, certPool *x509.CertPool, clientCert *tls.Certificate, verifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) *Connection {
-	connection := NewConnection(addr, user, pass)
-	connection.dial = func(network, address string) (net.Conn, error) {
-		conn, err := net.DialTimeout(network, address, 5*time.Second)
-		if err != nil {
-			return nil, err
-		}
-
-		br := bufio.NewReaderSize(conn, 32768)
-		_, err = Parse(br)
-		if err != nil {
-			return nil, err
-		}
-
-		hostname, _, err := net.SplitHostPort(address)
-		if err != nil {
-			return nil, err
-		}
+	return NewTLSConnectionWithConfig(addr, user, pass, newTLSConfig(certPool, clientCert, verifyPeerCertificate))
+}
 
-		config := tls.Config{
-			RootCAs:               certPool,
-			ServerName:            hostname,
-			VerifyPeerCertificate: verifyPeerCertificate,
-		}
+func newTLSConfig(certPool *x509.CertPool, clientCert *tls.Certificate, verifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) *tls.Config {
+	config := &tls.Config{
+		RootCAs:               certPool,
+		VerifyPeerCertificate: verifyPeerCertificate,
+	}
 
-		// When client certificate is provided, we are expecting mutual TLS.
-		if clientCert != nil {
-			config.Certificates = []tls.Certificate{*clientCert}
-		}
+	// When client certificate is provided, we are expecting mutual TLS.
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{*clientCert}
+	}
 
-		conn = tls.Client(conn, &config)
+	return config
+}
 
-		tlsConn := conn.(*tls.Conn)
-		err = tlsConn.Handshake()
-		return tlsConn, err
-	}
+// NewTLSConnectionWithConfig uses config as is, except that an empty
+// ServerName defaults to the host in addr.
+func NewTLSConnectionWithConfig(addr, user, pass string, config *tls.Config) *Connection {
+	connection := NewConnection(addr, user, pass)
+	connection.tlsConfig = config
 	return connection
 }
 
 type ConnectionInfo struct {
+	// Addr is a host:port, or a ws:// or wss:// URL to connect over
+	// WebSocket.
 	Addr     string
 	Username string
 	Password string
 	Dial     func(network, address string) (net.Conn, error)
 	TLSInfo  *ConnectionTLSInfo
+
+	// Network defaults to "tcp". With "unix", Addr is the socket path.
+	Network string
+
+	// DialTimeout defaults to DefaultDialTimeout. It applies to Dialer too
+	// unless the Dialer has a timeout of its own.
+	DialTimeout time.Duration
+
+	// Dialer opens the connection, for instance to bind a local address,
+	// tune keepalives or set socket options through its Control hook. Dial
+	// takes precedence over it.
+	Dialer *net.Dialer
+
+	// WriteTimeout defaults to DefaultWriteTimeout. A negative timeout lets
+	// writes block indefinitely.
+	WriteTimeout time.Duration
 }
 
 type ConnectionTLSInfo struct {
 	CertPool              *x509.CertPool
 	ClientCert            *tls.Certificate
 	VerifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+
+	// TLSConfig, when set, is used instead of the fields above.
+	TLSConfig *tls.Config
+
+	// CertFile, KeyFile and CAFile are read at connect time and reread
+	// whenever they change on disk. They are ignored when TLSConfig is set.
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	// RotationCheckInterval, when non-zero, is how often the files are
+	// checked while connected. A change closes the connection so that the
+	// client reconnects with the rotated credentials.
+	RotationCheckInterval time.Duration
+
+	// HandshakeFirst starts TLS as soon as the connection is open instead of
+	// after the server's INFO, for servers behind TLS-terminating proxies.
+	HandshakeFirst bool
+
+	// ServerName is checked against the server's certificate, overriding
+	// the one in TLSConfig. It defaults to the host in Addr and is required
+	// when Network is "unix".
+	ServerName string
 }
 
 func (c *ConnectionInfo) ProvideConnection() (*Connection, error) {
-	var conn *Connection
+	var tlsConfig *tls.Config
+	var reloader *certReloader
 
-	if c.TLSInfo == nil {
-		conn = NewConnection(c.Addr, c.Username, c.Password)
-	} else {
-		conn = NewTLSConnection(c.Addr, c.Username, c.Password, c.TLSInfo.CertPool, c.TLSInfo.ClientCert, c.TLSInfo.VerifyPeerCertificate)
+	if c.TLSInfo != nil {
+		var err error
+
+		tlsConfig, reloader, err = c.TLSInfo.config()
+		if err != nil {
+			return nil, err
+		}
+
+		if c.Network == "unix" && tlsConfig.ServerName == "" {
+			return nil, ErrServerNameRequired
+		}
 	}
 
-	if c.Dial != nil {
-		conn.dial = c.Dial
+	conn := NewConnection(c.Addr, c.Username, c.Password)
+
+	if c.WriteTimeout != 0 {
+		conn.SetWriteTimeout(c.WriteTimeout)
+	}
+
+	if isWebSocketURL(c.Addr) {
+		// TLS is negotiated by the WebSocket handshake for wss:// URLs
+		conn.dial = WebSocketDialer(c.Addr, tlsConfig, c.dialer())
+	} else {
+		conn.dial = c.dialer()
+		conn.tlsConfig = tlsConfig
+
+		if c.Network != "" {
+			conn.network = c.Network
+		}
+
+		if c.TLSInfo != nil {
+			conn.handshakeFirst = c.TLSInfo.HandshakeFirst
+		}
 	}
 
 	var err error
@@ -139,12 +249,85 @@ func (c *ConnectionInfo) ProvideConnection() (*Connection, error) {
 
 	err = conn.Handshake()
 	if err != nil {
+		conn.Disconnect()
 		return nil, err
 	}
 
+	if reloader != nil && c.TLSInfo.RotationCheckInterval > 0 {
+		go conn.reconnectOnRotation(reloader, c.TLSInfo.RotationCheckInterval)
+	}
+
 	return conn, nil
 }
 
+func (c *ConnectionInfo) dialer() func(network, address string) (net.Conn, error) {
+	if c.Dial != nil {
+		return c.Dial
+	}
+
+	dialer := net.Dialer{}
+	if c.Dialer != nil {
+		dialer = *c.Dialer
+	}
+
+	if dialer.Timeout == 0 {
+		dialer.Timeout = c.DialTimeout
+	}
+
+	if dialer.Timeout == 0 {
+		dialer.Timeout = DefaultDialTimeout
+	}
+
+	return dialer.Dial
+}
+
+func (t *ConnectionTLSInfo) config() (*tls.Config, *certReloader, error) {
+	var config *tls.Config
+	var reloader *certReloader
+
+	switch {
+	case t.TLSConfig != nil:
+		config = t.TLSConfig
+
+	case t.CertFile != "" || t.CAFile != "":
+		reloader = newCertReloader(t.CertFile, t.KeyFile, t.CAFile)
+
+		var err error
+		config, err = reloader.tlsConfig(t.VerifyPeerCertificate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+	default:
+		config = newTLSConfig(t.CertPool, t.ClientCert, t.VerifyPeerCertificate)
+	}
+
+	if t.ServerName != "" {
+		config = config.Clone()
+		config.ServerName = t.ServerName
+	}
+
+	return config, reloader, nil
+}
+
+// equal reports whether t and other configure TLS the same way.
+func (t *ConnectionTLSInfo) equal(other *ConnectionTLSInfo) bool {
+	if t == nil || other == nil {
+		return t == other
+	}
+
+	return t.CertPool.Equal(other.CertPool) &&
+		t.ClientCert == other.ClientCert &&
+		reflect.ValueOf(t.VerifyPeerCertificate).Pointer() == reflect.ValueOf(other.VerifyPeerCertificate).Pointer() &&
+		t.TLSConfig == other.TLSConfig &&
+		t.CertFile == other.CertFile &&
+		t.KeyFile == other.KeyFile &&
+		t.CAFile == other.CAFile &&
+		t.RotationCheckInterval == other.RotationCheckInterval &&
+		t.HandshakeFirst == other.HandshakeFirst &&
+		t.ServerName == other.ServerName
+}
+
 type ConnectionCluster struct {
 	Members []ConnectionProvider
 }
@@ -160,11 +343,21 @@ func (c *ConnectionCluster) ProvideConnection() (conn *Connection, err error) {
 }
 
 func (c *Connection) Dial() error {
-	conn, err := c.dial("tcp", c.addr)
+	conn, err := c.dial(c.network, c.addr)
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(setupTimeout))
+
+	conn, err = c.setUp(conn)
 	if err != nil {
+		conn.Close()
 		return err
 	}
 
+	conn.SetDeadline(time.Time{})
+
 	c.conn = conn
 
 	go c.receivePackets()
@@ -172,20 +365,150 @@ func (c *Connection) Dial() error {
 	return nil
 }
 
+// setUp reads the server's INFO and upgrades to TLS when the server requires
+// it. In handshake-first mode TLS starts straight away and INFO arrives over
+// the encrypted connection instead.
+func (c *Connection) setUp(conn net.Conn) (net.Conn, error) {
+	if c.tlsConfig != nil && c.handshakeFirst {
+		return c.upgradeTLS(conn)
+	}
+
+	reader := bufio.NewReaderSize(conn, 32768)
+
+	packet, err := Parse(reader)
+	if err != nil {
+		return conn, err
+	}
+
+	switch packet := packet.(type) {
+	case *InfoPacket:
+		c.receivedInfo(packet)
+	case *ERRPacket:
+		return conn, errors.New(packet.Message)
+	default:
+		return conn, ErrNoServerInfo
+	}
+
+	info := c.ServerInfo()
+
+	if info.TLSRequired && c.tlsConfig == nil {
+		return conn, ErrSecureConnRequired
+	}
+
+	// a server with tls_available accepts both, so upgrade only if asked to
+	if c.tlsConfig != nil {
+		if !info.TLSRequired && !info.TLSAvailable {
+			return conn, ErrSecureConnWanted
+		}
+
+		return c.upgradeTLS(conn)
+	}
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+
+	return conn, nil
+}
+
+func (c *Connection) upgradeTLS(conn net.Conn) (net.Conn, error) {
+	config := c.tlsConfig.Clone()
+
+	if config.ServerName == "" {
+		// a socket path names no host to check the certificate against
+		if c.network == "unix" {
+			return conn, ErrServerNameRequired
+		}
+
+		hostname, _, err := net.SplitHostPort(c.addr)
+		if err != nil {
+			return conn, err
+		}
+
+		config.ServerName = hostname
+	}
+
+	tlsConn := tls.Client(conn, config)
+
+	err := tlsConn.Handshake()
+	if err != nil {
+		return conn, err
+	}
+
+	return tlsConn, nil
+}
+
+// bufferedConn hands out whatever was read past INFO before reading from
+// the connection again.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
 func (c *Connection) OnMessage(callback func(*MsgPacket)) {
 	c.onMessage = callback
 }
 
+// OnLameDuck registers a callback that is called once when the server
+// announces that it is entering lame duck mode.
+func (c *Connection) OnLameDuck(callback func()) {
+	c.onLameDuck = callback
+}
+
+// SetWriteTimeout bounds how long a single write may block. A write that
+// times out closes the connection. Zero or negative disables the timeout.
+func (c *Connection) SetWriteTimeout(timeout time.Duration) {
+	c.writeLock.Lock()
+	c.writeTimeout = timeout
+	c.writeLock.Unlock()
+}
+
 func (c *Connection) Handshake() error {
-	c.Send(&ConnectPacket{User: c.user, Pass: c.pass})
-	return c.ErrOrOK()
+	err := c.Send(&ConnectPacket{User: c.user, Pass: c.pass, Headers: true})
+	if err != nil {
+		return err
+	}
+
+	err = c.errOrOK(setupTimeout)
+	if err != nil {
+		return err
+	}
+
+	// the server holds back INFO updates until it has answered a PING
+	_, err = c.rtt(setupTimeout)
+	return err
+}
+
+func (c *Connection) ServerInfo() ServerInfo {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+
+	return c.serverInfo
 }
 
 func (c *Connection) Disconnect() {
+	c.closeOnce.Do(func() { close(c.closed) })
 	c.conn.Close()
 }
 
 func (c *Connection) ErrOrOK() error {
+	return c.errOrOK(0)
+}
+
+// errOrOK waits for +OK or -ERR, giving up after timeout unless it is zero.
+func (c *Connection) errOrOK(timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		expired = timer.C
+	}
+
 	c.Logger().Debug("connection.err-or-ok.wait")
 	select {
 	case err := <-c.errs:
@@ -194,32 +517,62 @@ func (c *Connection) ErrOrOK() error {
 	case <-c.oks:
 		c.Logger().Debug("connection.err-or-ok.ok")
 		return nil
+	case <-expired:
+		c.Logger().Warn("connection.err-or-ok.timeout")
+		return ErrOKTimeout
 	}
 }
 
-func (c *Connection) Send(packet Packet) {
-	c.Logger().Debugd(map[string]interface{}{"packet": packet}, "connection.packet.send")
+func (c *Connection) Send(packet Packet) error {
+	c.Logger().Debugd(map[string]interface{}{"packet": c.Redactor().Redact(packet)}, "connection.packet.send")
 
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
 
-	// ignore write errors; readPackets will notice connection being interrupted
-	_, err := c.conn.Write(packet.Encode())
-	if err != nil {
-		c.Logger().Errord(map[string]interface{}{"error": err.Error()}, "connection.packet.write-error")
-	}
-
-	return
+	return c.write(packet)
 }
 
 func (c *Connection) Ping() bool {
-	c.Send(&PingPacket{})
+	_, err := c.RTT()
+	return err == nil
+}
+
+// RTT sends a PING and measures the time until the matching PONG arrives.
+// PONGs are matched to PINGs in the order they were sent, so a late PONG
+// for a timed out PING is never mistaken for the answer to a later one.
+func (c *Connection) RTT() (time.Duration, error) {
+	return c.rtt(500 * time.Millisecond)
+}
+
+func (c *Connection) rtt(timeout time.Duration) (time.Duration, error) {
+	pong := make(chan time.Time, 1)
+
+	c.Logger().Debug("connection.packet.ping-send")
+
+	c.writeLock.Lock()
+
+	c.pongLock.Lock()
+	c.pendingPongs = append(c.pendingPongs, pong)
+	c.pongLock.Unlock()
+
+	err := c.write(&PingPacket{})
+	sentAt := time.Now()
+
+	c.writeLock.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
 
 	select {
-	case _, ok := <-c.pongs:
-		return ok
-	case <-time.After(500 * time.Millisecond):
-		return false
+	case receivedAt, ok := <-pong:
+		if !ok {
+			return 0, ErrDisconnected
+		}
+
+		return receivedAt.Sub(sentAt), nil
+	case <-time.After(timeout):
+		return 0, ErrPingTimeout
 	}
 }
 
@@ -236,6 +589,25 @@ func (c *Connection) Logger() Logger {
 	return c.logger
 }
 
+// SetRedactor replaces the redactor packets pass through before they are
+// logged. nil restores the default one from NewRedactor.
+func (c *Connection) SetRedactor(redactor *Redactor) {
+	if redactor == nil {
+		redactor = NewRedactor()
+	}
+
+	c.loggerMutex.Lock()
+	c.redactor = redactor
+	c.loggerMutex.Unlock()
+}
+
+func (c *Connection) Redactor() *Redactor {
+	c.loggerMutex.RLock()
+	defer c.loggerMutex.RUnlock()
+
+	return c.redactor
+}
+
 func (c *Connection) receivePackets() {
 	io := bufio.NewReader(c.conn)
 
@@ -246,20 +618,14 @@ func (c *Connection) receivePackets() {
 		if err != nil {
 			c.Logger().Errord(map[string]interface{}{"error": err.Error()}, "connection.packet.read-error")
 			c.Disconnect()
-			c.disconnected()
+			c.disconnected(err)
 			break
 		}
 
 		switch packet.(type) {
 		case *PongPacket:
 			c.Logger().Debug("connection.packet.pong-received")
-
-			select {
-			case c.pongs <- packet.(*PongPacket):
-				c.Logger().Debug("connection.packet.pong-served")
-			default:
-				c.Logger().Debug("connection.packet.pong-unhandled")
-			}
+			c.receivedPong()
 
 		case *PingPacket:
 			c.Logger().Debug("connection.packet.ping-received")
@@ -267,7 +633,10 @@ func (c *Connection) receivePackets() {
 
 		case *OKPacket:
 			c.Logger().Debug("connection.packet.ok-received")
-			c.oks <- packet.(*OKPacket)
+			select {
+			case c.oks <- packet.(*OKPacket):
+			case <-c.closed:
+			}
 
 		case *ERRPacket:
 			c.Logger().Debug("connection.packet.err-received")
@@ -275,11 +644,11 @@ func (c *Connection) receivePackets() {
 
 		case *InfoPacket:
 			c.Logger().Debug("connection.packet.info-received")
-			// noop
+			c.receivedInfo(packet.(*InfoPacket))
 
 		case *MsgPacket:
 			c.Logger().Debugd(
-				map[string]interface{}{"packet": packet},
+				map[string]interface{}{"packet": c.Redactor().Redact(packet)},
 				"connection.packet.msg-received",
 			)
 
@@ -288,7 +657,90 @@ func (c *Connection) receivePackets() {
 	}
 }
 
-func (c *Connection) disconnected() {
-	c.Disconnected <- true
-	c.errs <- errors.New("disconnected")
+func (c *Connection) write(packet Packet) error {
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+
+	_, err := c.conn.Write(packet.Encode())
+	if err != nil {
+		c.Logger().Errord(map[string]interface{}{"error": err.Error()}, "connection.packet.write-error")
+
+		// a partial write leaves the stream unusable; closing it makes
+		// receivePackets report the disconnect so the client reconnects
+		c.conn.Close()
+	}
+
+	return err
+}
+
+func (c *Connection) receivedInfo(packet *InfoPacket) {
+	info, err := packet.ServerInfo()
+	if err != nil {
+		c.Logger().Warnd(map[string]interface{}{"error": err.Error()}, "connection.packet.info-invalid")
+		return
+	}
+
+	c.infoLock.Lock()
+	c.serverInfo = info
+	enteredLameDuck := info.LameDuckMode && !c.lameDuck
+	if enteredLameDuck {
+		c.lameDuck = true
+	}
+	c.infoLock.Unlock()
+
+	if enteredLameDuck {
+		c.Logger().Info("connection.lame-duck")
+
+		if c.onLameDuck != nil {
+			c.onLameDuck()
+		}
+	}
+}
+
+func (c *Connection) retire() {
+	c.retireOnce.Do(func() { close(c.retired) })
+}
+
+func (c *Connection) receivedPong() {
+	receivedAt := time.Now()
+
+	c.pongLock.Lock()
+	defer c.pongLock.Unlock()
+
+	if len(c.pendingPongs) == 0 {
+		c.Logger().Debug("connection.packet.pong-unhandled")
+		return
+	}
+
+	pong := c.pendingPongs[0]
+	c.pendingPongs = c.pendingPongs[1:]
+
+	pong <- receivedAt
+	c.Logger().Debug("connection.packet.pong-served")
+}
+
+// disconnected fails anyone waiting on the connection. A clean EOF is
+// reported as ErrDisconnected; anything else, such as a TLS alert sent when
+// the server rejects a client certificate, is passed on as is.
+func (c *Connection) disconnected(err error) {
+	if err == io.EOF {
+		err = ErrDisconnected
+	}
+
+	c.pongLock.Lock()
+	for _, pong := range c.pendingPongs {
+		close(pong)
+	}
+	c.pendingPongs = nil
+	c.pongLock.Unlock()
+
+	// close rather than send; nobody is listening while a connection is
+	// still handshaking, and a blocked send would hang ErrOrOK forever
+	close(c.Disconnected)
+
+	select {
+	case c.errs <- err:
+	default:
+	}
 }
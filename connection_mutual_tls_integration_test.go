@@ -2,26 +2,30 @@ package yagnats
 
 import (
 	"crypto/x509"
-	"os/exec"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
 
 	"errors"
+	"github.com/nats-io/nats-server/v2/server"
 	. "gopkg.in/check.v1"
 )
 
 type MutualTLSSuite struct {
-	Client   *Client
-	NatsConn NATSConn
-	NatsCmd  *exec.Cmd
+	Client     *Client
+	NatsConn   NATSConn
+	NatsServer *server.Server
 }
 
 var _ = Suite(&MutualTLSSuite{})
 
 func (t *MutualTLSSuite) SetUpSuite(c *C) {
-	t.NatsCmd = startNatsMutualTLS(4556)
+	t.NatsServer = startNatsMutualTLS(4556)
 }
 
 func (t *MutualTLSSuite) TearDownSuite(c *C) {
-	stopCmd(t.NatsCmd)
+	stopNats(t.NatsServer)
 }
 
 func (t *MutualTLSSuite) TestNewMutualTLSConnection(c *C) {
@@ -63,7 +67,7 @@ func (t *MutualTLSSuite) TestNewMutualTLSConnectionWithWrongCA(c *C) {
 	})
 
 	c.Assert(err, NotNil)
-	c.Assert(err.Error(), Matches, "^x509: certificate signed by unknown authority.*$")
+	c.Assert(err.Error(), Matches, "^tls: failed to verify certificate: x509: certificate signed by unknown authority.*$")
 }
 
 func (t *MutualTLSSuite) TestNewMutualTLSConnectionWithEmptyCertPool(c *C) {
@@ -79,7 +83,7 @@ func (t *MutualTLSSuite) TestNewMutualTLSConnectionWithEmptyCertPool(c *C) {
 	})
 
 	c.Assert(err, NotNil)
-	c.Assert(err.Error(), Equals, "x509: certificate signed by unknown authority")
+	c.Assert(err.Error(), Equals, "tls: failed to verify certificate: x509: certificate signed by unknown authority")
 }
 
 func (t *MutualTLSSuite) TestNewMutualTLSConnectionWithInvalidClientCert(c *C) {
@@ -99,7 +103,7 @@ func (t *MutualTLSSuite) TestNewMutualTLSConnectionWithInvalidClientCert(c *C) {
 	})
 
 	c.Assert(err, NotNil)
-	c.Assert(err.Error(), Equals, "remote error: tls: bad certificate")
+	c.Assert(err.Error(), Equals, "remote error: tls: unknown certificate authority")
 
 	pingSuccess := client.Ping()
 	c.Assert(pingSuccess, Equals, false)
@@ -121,7 +125,7 @@ func (t *MutualTLSSuite) TestNewMutualTLSConnectionWithNoClientCert(c *C) {
 	})
 
 	c.Assert(err, NotNil)
-	c.Assert(err.Error(), Equals, "remote error: tls: bad certificate")
+	c.Assert(err.Error(), Equals, "remote error: tls: certificate required")
 
 	pingSuccess := client.Ping()
 	c.Assert(pingSuccess, Equals, false)
@@ -190,3 +194,138 @@ func (t *MutualTLSSuite) TestNewMutualTLSConnectionWithVerifyPeerCertificateCall
 	pingSuccess := client.Ping()
 	c.Assert(pingSuccess, Equals, false)
 }
+
+func (t *MutualTLSSuite) TestNewMutualTLSConnectionFromFiles(c *C) {
+	dir := copyTLSAssets(c)
+
+	client := NewClient()
+
+	err := client.Connect(&ConnectionInfo{Addr: "127.0.0.1:4556",
+		Username: "nats",
+		Password: "nats",
+		TLSInfo: &ConnectionTLSInfo{
+			CertFile: filepath.Join(dir, "client-cert.pem"),
+			KeyFile:  filepath.Join(dir, "client-pkey.pem"),
+			CAFile:   filepath.Join(dir, "ca.pem"),
+		},
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	c.Assert(client.Ping(), Equals, true)
+}
+
+func (t *MutualTLSSuite) TestNewMutualTLSConnectionFromMissingFiles(c *C) {
+	dir := c.MkDir()
+
+	client := NewClient()
+
+	err := client.Connect(&ConnectionInfo{Addr: "127.0.0.1:4556",
+		Username: "nats",
+		Password: "nats",
+		TLSInfo: &ConnectionTLSInfo{
+			CertFile: filepath.Join(dir, "client-cert.pem"),
+			KeyFile:  filepath.Join(dir, "client-pkey.pem"),
+			CAFile:   filepath.Join(dir, "ca.pem"),
+		},
+	})
+	c.Assert(err, NotNil)
+}
+
+func (t *MutualTLSSuite) TestNewMutualTLSConnectionReconnectsOnRotation(c *C) {
+	dir := copyTLSAssets(c)
+
+	client := NewClient()
+
+	err := client.Connect(&ConnectionInfo{Addr: "127.0.0.1:4556",
+		Username: "nats",
+		Password: "nats",
+		TLSInfo: &ConnectionTLSInfo{
+			CertFile:              filepath.Join(dir, "client-cert.pem"),
+			KeyFile:               filepath.Join(dir, "client-pkey.pem"),
+			CAFile:                filepath.Join(dir, "ca.pem"),
+			RotationCheckInterval: 50 * time.Millisecond,
+		},
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	rotated := time.Now().Add(time.Minute)
+	err = os.Chtimes(filepath.Join(dir, "client-cert.pem"), rotated, rotated)
+	c.Assert(err, IsNil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Statistics().Reconnects == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	c.Assert(client.Statistics().Reconnects, Equals, uint64(1))
+	c.Assert(client.Ping(), Equals, true)
+}
+
+func (t *MutualTLSSuite) TestNATSGoClientReconnectsOnRotation(c *C) {
+	dir := copyTLSAssets(c)
+
+	client := NewClientWithNATSGo()
+
+	err := client.Connect(&ConnectionInfo{Addr: "127.0.0.1:4556",
+		Username: "nats",
+		Password: "nats",
+		TLSInfo: &ConnectionTLSInfo{
+			CertFile:              filepath.Join(dir, "client-cert.pem"),
+			KeyFile:               filepath.Join(dir, "client-pkey.pem"),
+			CAFile:                filepath.Join(dir, "ca.pem"),
+			RotationCheckInterval: 50 * time.Millisecond,
+		},
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	conn := client.(*natsGoClient).connection()
+
+	rotated := time.Now().Add(time.Minute)
+	err = os.Chtimes(filepath.Join(dir, "client-cert.pem"), rotated, rotated)
+	c.Assert(err, IsNil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for conn.Stats().Reconnects == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	c.Assert(conn.Stats().Reconnects, Equals, uint64(1))
+	c.Assert(client.Ping(), Equals, true)
+}
+
+func (t *MutualTLSSuite) TestNATSGoClientRejectsMixedTLSInfo(c *C) {
+	client := NewClientWithNATSGo()
+
+	err := client.Connect(&ConnectionCluster{
+		[]ConnectionProvider{
+			&ConnectionInfo{Addr: "127.0.0.1:4556", TLSInfo: &ConnectionTLSInfo{CAFile: "assets/ca.pem"}},
+			&ConnectionInfo{Addr: "127.0.0.1:4556", TLSInfo: &ConnectionTLSInfo{CAFile: "assets/invalid-ca.pem"}},
+		},
+	})
+	c.Assert(err, Equals, ErrMixedTLSInfo)
+
+	err = client.Connect(&ConnectionCluster{
+		[]ConnectionProvider{
+			&ConnectionInfo{Addr: "127.0.0.1:4556", TLSInfo: &ConnectionTLSInfo{CAFile: "assets/ca.pem"}},
+			&ConnectionInfo{Addr: "127.0.0.1:4556"},
+		},
+	})
+	c.Assert(err, Equals, ErrMixedTLSInfo)
+}
+
+func copyTLSAssets(c *C) string {
+	dir := c.MkDir()
+
+	for _, name := range []string{"ca.pem", "client-cert.pem", "client-pkey.pem"} {
+		contents, err := ioutil.ReadFile(filepath.Join("assets", name))
+		c.Assert(err, IsNil)
+
+		err = ioutil.WriteFile(filepath.Join(dir, name), contents, 0600)
+		c.Assert(err, IsNil)
+	}
+
+	return dir
+}
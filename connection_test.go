@@ -1,7 +1,11 @@
 package yagnats
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
 	"sync"
 	"time"
 
@@ -66,6 +70,151 @@ func (s *CSuite) TestConnectionUnexpectedPong(c *C) {
 	waitReceive(c, "PONG\r\n", conn.WriteChan, 500)
 }
 
+func (s *CSuite) TestConnectionRTT(c *C) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	s.Connection.conn = client
+	go s.Connection.receivePackets()
+
+	go func() {
+		br := bufio.NewReader(server)
+		br.ReadString('\n')
+		time.Sleep(50 * time.Millisecond)
+		server.Write([]byte("PONG\r\n"))
+	}()
+
+	rtt, err := s.Connection.RTT()
+	c.Assert(err, IsNil)
+	c.Assert(rtt >= 50*time.Millisecond, Equals, true)
+}
+
+func (s *CSuite) TestConnectionRTTIgnoresUnsolicitedPong(c *C) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	s.Connection.conn = client
+	go s.Connection.receivePackets()
+
+	server.Write([]byte("PONG\r\n"))
+	time.Sleep(50 * time.Millisecond)
+
+	go func() {
+		br := bufio.NewReader(server)
+		br.ReadString('\n')
+		time.Sleep(100 * time.Millisecond)
+		server.Write([]byte("PONG\r\n"))
+	}()
+
+	rtt, err := s.Connection.RTT()
+	c.Assert(err, IsNil)
+	c.Assert(rtt >= 100*time.Millisecond, Equals, true)
+}
+
+func (s *CSuite) TestConnectionRTTDoesNotMatchLatePong(c *C) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	s.Connection.conn = client
+	go s.Connection.receivePackets()
+
+	go func() {
+		br := bufio.NewReader(server)
+
+		br.ReadString('\n')
+		time.Sleep(700 * time.Millisecond)
+		server.Write([]byte("PONG\r\n"))
+
+		br.ReadString('\n')
+		time.Sleep(100 * time.Millisecond)
+		server.Write([]byte("PONG\r\n"))
+	}()
+
+	_, err := s.Connection.RTT()
+	c.Assert(err, Equals, ErrPingTimeout)
+
+	rtt, err := s.Connection.RTT()
+	c.Assert(err, IsNil)
+	c.Assert(rtt >= 100*time.Millisecond, Equals, true)
+}
+
+func (s *CSuite) TestConnectionHandshakeWaitsLongerThanRTT(c *C) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	s.Connection.conn = client
+	go s.Connection.receivePackets()
+
+	go func() {
+		br := bufio.NewReader(server)
+
+		br.ReadString('\n')
+		server.Write([]byte("+OK\r\n"))
+
+		br.ReadString('\n')
+		time.Sleep(700 * time.Millisecond)
+		server.Write([]byte("PONG\r\n"))
+	}()
+
+	c.Assert(s.Connection.Handshake(), IsNil)
+}
+
+func (s *CSuite) TestProvideConnectionClosesAfterHandshakeTimeout(c *C) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	closed := make(chan error, 1)
+
+	go func() {
+		serverSide.Write([]byte("INFO {}\r\n"))
+
+		br := bufio.NewReader(serverSide)
+		br.ReadString('\n')
+
+		// never answer CONNECT, and wait for the client to hang up
+		_, err := br.ReadString('\n')
+		closed <- err
+	}()
+
+	info := &ConnectionInfo{
+		Addr: "127.0.0.1:4222",
+		Dial: func(network, address string) (net.Conn, error) {
+			return clientSide, nil
+		},
+	}
+
+	_, err := info.ProvideConnection()
+	c.Assert(err, Equals, ErrOKTimeout)
+
+	select {
+	case err := <-closed:
+		c.Assert(err, Equals, io.EOF)
+	case <-time.After(1 * time.Second):
+		c.Error("Connection was never closed.")
+	}
+}
+
+func (s *CSuite) TestConnectionRTTOnDisconnect(c *C) {
+	client, server := net.Pipe()
+
+	connection := s.Connection
+	connection.conn = client
+	go connection.receivePackets()
+
+	go func() {
+		<-connection.Disconnected
+	}()
+
+	go func() {
+		br := bufio.NewReader(server)
+		br.ReadString('\n')
+		server.Close()
+	}()
+
+	_, err := connection.RTT()
+	c.Assert(err, Equals, ErrDisconnected)
+}
+
 func (s *CSuite) TestConnectionDisconnect(c *C) {
 	conn := &fakeConn{
 		ReadBuffer:  bytes.NewBuffer([]byte{}),
@@ -233,3 +382,155 @@ func (s *CSuite) TestConnectionClusterReconnectsAnother(c *C) {
 	c.Assert(goodbyes, Equals, 1)
 	c.Assert(errs, Equals, 1)
 }
+
+func (s *CSuite) TestConnectionDialUpgradesWhenServerRequiresTLS(c *C) {
+	clientSide, serverSide := net.Pipe()
+
+	firstByte := make(chan byte, 1)
+
+	go func() {
+		serverSide.Write([]byte("INFO {\"tls_required\":true}\r\n"))
+
+		record := make([]byte, 1)
+		serverSide.Read(record)
+		serverSide.Close()
+
+		firstByte <- record[0]
+	}()
+
+	conn := NewTLSConnectionWithConfig("127.0.0.1:4222", "", "", &tls.Config{})
+	conn.dial = func(network, address string) (net.Conn, error) {
+		return clientSide, nil
+	}
+
+	err := conn.Dial()
+	c.Assert(err, NotNil)
+	c.Assert(conn.ServerInfo().TLSRequired, Equals, true)
+
+	// 0x16 starts a TLS handshake record
+	c.Assert(<-firstByte, Equals, byte(0x16))
+}
+
+func (s *CSuite) TestConnectionDialUpgradesWhenServerOffersTLS(c *C) {
+	clientSide, serverSide := net.Pipe()
+
+	firstByte := make(chan byte, 1)
+
+	go func() {
+		serverSide.Write([]byte("INFO {\"tls_available\":true}\r\n"))
+
+		record := make([]byte, 1)
+		serverSide.Read(record)
+		serverSide.Close()
+
+		firstByte <- record[0]
+	}()
+
+	conn := NewTLSConnectionWithConfig("127.0.0.1:4222", "", "", &tls.Config{})
+	conn.dial = func(network, address string) (net.Conn, error) {
+		return clientSide, nil
+	}
+
+	err := conn.Dial()
+	c.Assert(err, NotNil)
+	c.Assert(conn.ServerInfo().TLSAvailable, Equals, true)
+
+	c.Assert(<-firstByte, Equals, byte(0x16))
+}
+
+func (s *CSuite) TestConnectionDialOverUnixSocketRequiresServerName(c *C) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	go func() {
+		serverSide.Write([]byte("INFO {\"tls_required\":true}\r\n"))
+	}()
+
+	conn := NewTLSConnectionWithConfig("/tmp/nats.sock", "", "", &tls.Config{})
+	conn.network = "unix"
+	conn.dial = func(network, address string) (net.Conn, error) {
+		return clientSide, nil
+	}
+
+	c.Assert(conn.Dial(), Equals, ErrServerNameRequired)
+}
+
+func (s *CSuite) TestProvideConnectionOverUnixSocketRequiresServerName(c *C) {
+	dialed := false
+
+	info := &ConnectionInfo{
+		Network: "unix",
+		Addr:    "/tmp/nats.sock",
+		TLSInfo: &ConnectionTLSInfo{},
+		Dial: func(network, address string) (net.Conn, error) {
+			dialed = true
+			return nil, io.EOF
+		},
+	}
+
+	_, err := info.ProvideConnection()
+	c.Assert(err, Equals, ErrServerNameRequired)
+	c.Assert(dialed, Equals, false)
+}
+
+func (s *CSuite) TestConnectionDialWithoutServerInfo(c *C) {
+	clientSide, serverSide := net.Pipe()
+
+	go func() {
+		serverSide.Write([]byte("PING\r\n"))
+	}()
+
+	conn := NewConnection("127.0.0.1:4222", "", "")
+	conn.dial = func(network, address string) (net.Conn, error) {
+		return clientSide, nil
+	}
+
+	c.Assert(conn.Dial(), Equals, ErrNoServerInfo)
+}
+
+func (s *CSuite) TestConnectionOnLameDuckCallback(c *C) {
+	conn := &fakeConn{
+		ReadBuffer:  bytes.NewBuffer([]byte("INFO {\"ldm\":true}\r\nINFO {\"ldm\":true}\r\nPING\r\n")),
+		WriteBuffer: bytes.NewBuffer([]byte{}),
+		WriteChan:   make(chan []byte),
+	}
+
+	s.Connection.conn = conn
+
+	lameDucks := make(chan bool, 2)
+
+	s.Connection.OnLameDuck(func() {
+		lameDucks <- true
+	})
+
+	go s.Connection.receivePackets()
+
+	waitReceive(c, "PONG\r\n", conn.WriteChan, 500)
+
+	c.Assert(len(lameDucks), Equals, 1)
+	c.Assert(s.Connection.ServerInfo().LameDuckMode, Equals, true)
+}
+
+func (s *CSuite) TestConnectionSendTimesOutOnStuckSocket(c *C) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	s.Connection.conn = clientSide
+	s.Connection.SetWriteTimeout(100 * time.Millisecond)
+
+	go s.Connection.receivePackets()
+
+	// nothing reads from serverSide, so the write blocks
+	err := s.Connection.Send(&PingPacket{})
+	c.Assert(err, NotNil)
+
+	netErr, ok := err.(net.Error)
+	c.Assert(ok, Equals, true)
+	c.Assert(netErr.Timeout(), Equals, true)
+
+	select {
+	case <-s.Connection.Disconnected:
+	case <-time.After(time.Second):
+		c.Error("Connection was not closed after the write timed out.")
+	}
+}
@@ -1,8 +1,13 @@
 package fakeyagnats
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/cloudfoundry/yagnats"
 	nats "github.com/nats-io/nats.go"
 )
 
@@ -21,20 +26,157 @@ type FakeNATSConn struct {
 	onPing       func() bool
 	pingResponse bool
 
+	subscriptionIDs    map[*nats.Subscription]int64
+	nextSubscriptionID int64
+	queueSelector      QueueSelector
+
+	syncSubscriptions map[*nats.Subscription]chan *nats.Msg
+	inboxCounter      int
+
+	status       nats.Status
+	stats        nats.Statistics
+	connectedURL string
+	lastError    error
+
+	reconnectedCallbacks  []connCallback
+	closedCallbacks       []connCallback
+	disconnectedCallbacks []connCallback
+	errorCallbacks        []errorCallback
+	callbackCounter       int
+
 	sync.RWMutex
 }
 
+type connCallback struct {
+	id      int
+	handler func(*nats.Conn)
+}
+
+type errorCallback struct {
+	id      int
+	handler func(*nats.Conn, *nats.Subscription, error)
+}
+
 func Connect() *FakeNATSConn {
 	fake := &FakeNATSConn{}
 	fake.Reset()
 	return fake
 }
 
-func (f *FakeNATSConn) AddReconnectedCB(_ func(*nats.Conn)) {}
+func (f *FakeNATSConn) AddReconnectedCB(handler func(*nats.Conn)) func() {
+	return f.addConnCallback(&f.reconnectedCallbacks, handler)
+}
+
+func (f *FakeNATSConn) AddClosedCB(handler func(*nats.Conn)) func() {
+	return f.addConnCallback(&f.closedCallbacks, handler)
+}
+
+func (f *FakeNATSConn) AddDisconnectedCB(handler func(*nats.Conn)) func() {
+	return f.addConnCallback(&f.disconnectedCallbacks, handler)
+}
 
-func (f *FakeNATSConn) AddClosedCB(_ func(*nats.Conn)) {}
+func (f *FakeNATSConn) addConnCallback(callbacks *[]connCallback, handler func(*nats.Conn)) func() {
+	f.Lock()
+	defer f.Unlock()
+
+	f.callbackCounter++
+	id := f.callbackCounter
+	*callbacks = append(*callbacks, connCallback{id: id, handler: handler})
+
+	return func() {
+		f.Lock()
+		defer f.Unlock()
+
+		for i, cb := range *callbacks {
+			if cb.id == id {
+				*callbacks = append((*callbacks)[:i:i], (*callbacks)[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// SimulateDisconnect makes Ping and Publish fail until SimulateReconnect
+// and calls the disconnected callbacks in the order they were added. The
+// *nats.Conn they receive is nil.
+func (f *FakeNATSConn) SimulateDisconnect() {
+	f.Lock()
+	if f.status != nats.CONNECTED {
+		f.Unlock()
+		return
+	}
+	f.status = nats.RECONNECTING
+	callbacks := f.disconnectedCallbacks
+	f.Unlock()
 
-func (f *FakeNATSConn) AddDisconnectedCB(_ func(*nats.Conn)) {}
+	runConnCallbacks(callbacks)
+}
+
+// SimulateReconnect counts a reconnect and calls the reconnected callbacks.
+func (f *FakeNATSConn) SimulateReconnect() {
+	f.Lock()
+	if f.status != nats.RECONNECTING {
+		f.Unlock()
+		return
+	}
+	f.status = nats.CONNECTED
+	f.stats.Reconnects++
+	callbacks := f.reconnectedCallbacks
+	f.Unlock()
+
+	runConnCallbacks(callbacks)
+}
+
+// SimulateClose closes the fake as Close does: the disconnected callbacks
+// run if it was connected, then the closed callbacks.
+func (f *FakeNATSConn) SimulateClose() {
+	f.Close()
+}
+
+func runConnCallbacks(callbacks []connCallback) {
+	for _, cb := range callbacks {
+		cb.handler(nil)
+	}
+}
+
+func (f *FakeNATSConn) AddDiscoveredServersCB(_ func(*nats.Conn)) func() { return func() {} }
+
+func (f *FakeNATSConn) AddLameDuckModeCB(_ func(*nats.Conn)) func() { return func() {} }
+
+func (f *FakeNATSConn) AddErrorCB(handler func(*nats.Conn, *nats.Subscription, error)) func() {
+	f.Lock()
+	defer f.Unlock()
+
+	f.callbackCounter++
+	id := f.callbackCounter
+	f.errorCallbacks = append(f.errorCallbacks, errorCallback{id: id, handler: handler})
+
+	return func() {
+		f.Lock()
+		defer f.Unlock()
+
+		for i, cb := range f.errorCallbacks {
+			if cb.id == id {
+				f.errorCallbacks = append(f.errorCallbacks[:i:i], f.errorCallbacks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// SimulateAsyncError records err as the last error and passes it to the
+// error callbacks in the order they were added, as nats.go does for slow
+// consumers. The *nats.Conn they receive is nil.
+func (f *FakeNATSConn) SimulateAsyncError(subscription *nats.Subscription, err error) {
+	f.Lock()
+	f.lastError = err
+	callbacks := f.errorCallbacks
+	f.Unlock()
+
+	for _, cb := range callbacks {
+		cb.handler(nil, subscription, err)
+	}
+}
 
 func (f *FakeNATSConn) Reset() {
 	f.Lock()
@@ -52,6 +194,31 @@ func (f *FakeNATSConn) Reset() {
 	f.whenPublishing = map[string]func(*nats.Msg) error{}
 
 	f.pingResponse = true
+
+	f.subscriptionIDs = map[*nats.Subscription]int64{}
+	f.nextSubscriptionID = 0
+	f.queueSelector = RandomQueueSelector(time.Now().UnixNano())
+
+	f.syncSubscriptions = map[*nats.Subscription]chan *nats.Msg{}
+	f.inboxCounter = 0
+
+	f.status = nats.CONNECTED
+	f.stats = nats.Statistics{}
+	f.connectedURL = nats.DefaultURL
+	f.lastError = nil
+
+	f.reconnectedCallbacks = nil
+	f.closedCallbacks = nil
+	f.disconnectedCallbacks = nil
+	f.errorCallbacks = nil
+}
+
+// SetQueueSelector sets how the member of a queue group that receives a
+// message is picked. It defaults to RandomQueueSelector.
+func (f *FakeNATSConn) SetQueueSelector(selector QueueSelector) {
+	f.Lock()
+	f.queueSelector = selector
+	f.Unlock()
 }
 
 func (f *FakeNATSConn) OnPing(onPingCallback func() bool) {
@@ -64,8 +231,13 @@ func (f *FakeNATSConn) Ping() bool {
 	f.RLock()
 	onPing := f.onPing
 	response := f.pingResponse
+	status := f.status
 	f.RUnlock()
 
+	if status != nats.CONNECTED {
+		return false
+	}
+
 	if onPing != nil {
 		return onPing()
 	}
@@ -74,6 +246,95 @@ func (f *FakeNATSConn) Ping() bool {
 }
 
 func (f *FakeNATSConn) Close() {
+	f.Lock()
+	status := f.status
+	f.status = nats.CLOSED
+	disconnected := f.disconnectedCallbacks
+	closed := f.closedCallbacks
+	f.Unlock()
+
+	if status == nats.CLOSED {
+		return
+	}
+
+	if status == nats.CONNECTED {
+		runConnCallbacks(disconnected)
+	}
+
+	runConnCallbacks(closed)
+}
+
+// Drain closes the fake; messages are delivered synchronously so there is
+// never anything left to drain.
+func (f *FakeNATSConn) Drain() error {
+	if f.Status() == nats.CLOSED {
+		return nats.ErrConnectionClosed
+	}
+
+	f.Close()
+	return nil
+}
+
+func (f *FakeNATSConn) Flush() error {
+	return f.FlushTimeout(time.Minute)
+}
+
+func (f *FakeNATSConn) FlushTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return nats.ErrBadTimeout
+	}
+
+	return f.connectionError()
+}
+
+func (f *FakeNATSConn) connectionError() error {
+	switch f.Status() {
+	case nats.CLOSED:
+		return nats.ErrConnectionClosed
+	case nats.RECONNECTING:
+		return nats.ErrConnectionReconnecting
+	default:
+		return nil
+	}
+}
+
+func (f *FakeNATSConn) Status() nats.Status {
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.status
+}
+
+func (f *FakeNATSConn) Stats() nats.Statistics {
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.stats
+}
+
+func (f *FakeNATSConn) ConnectedUrl() string {
+	f.RLock()
+	defer f.RUnlock()
+
+	if f.status != nats.CONNECTED {
+		return ""
+	}
+
+	return f.connectedURL
+}
+
+func (f *FakeNATSConn) LastError() error {
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.lastError
+}
+
+// SetLastError sets the error returned by LastError.
+func (f *FakeNATSConn) SetLastError(err error) {
+	f.Lock()
+	f.lastError = err
+	f.Unlock()
 }
 
 func (f *FakeNATSConn) Options() nats.Options {
@@ -85,18 +346,16 @@ func (f *FakeNATSConn) Publish(subject string, payload []byte) error {
 }
 
 func (f *FakeNATSConn) PublishRequest(subject, reply string, payload []byte) error {
+	err := f.connectionError()
+	if err != nil {
+		return err
+	}
+
 	f.RLock()
 
 	injectedCallback, injected := f.whenPublishing[subject]
 
-	callbacks := []nats.MsgHandler{}
-
-	if subs := f.subscriptions[subject]; subs != nil {
-		callbacks = make([]nats.MsgHandler, 0)
-		for _, cb := range subs {
-			callbacks = append(callbacks, cb)
-		}
-	}
+	callbacks := f.recipients(subject)
 
 	f.RUnlock()
 
@@ -115,6 +374,10 @@ func (f *FakeNATSConn) PublishRequest(subject, reply string, payload []byte) err
 
 	f.Lock()
 	f.publishedMessages[subject] = append(f.publishedMessages[subject], message)
+	f.stats.OutMsgs++
+	f.stats.OutBytes += uint64(len(payload))
+	f.stats.InMsgs += uint64(len(callbacks))
+	f.stats.InBytes += uint64(len(callbacks) * len(payload))
 	f.Unlock()
 
 	for _, cb := range callbacks {
@@ -152,6 +415,143 @@ func (f *FakeNATSConn) QueueSubscribe(subject, queue string, callback nats.MsgHa
 	return subscription, nil
 }
 
+func (f *FakeNATSConn) ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return f.Subscribe(subject, func(msg *nats.Msg) {
+		ch <- msg
+	})
+}
+
+// SubscribeSync returns a subscription whose messages are read with
+// NextMsg on the fake; the real Subscription.NextMsg does not work on it.
+func (f *FakeNATSConn) SubscribeSync(subject string) (*nats.Subscription, error) {
+	ch := make(chan *nats.Msg, 65536)
+
+	subscription, err := f.ChanSubscribe(subject, ch)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Lock()
+	f.syncSubscriptions[subscription] = ch
+	f.Unlock()
+
+	return subscription, nil
+}
+
+func (f *FakeNATSConn) NextMsg(subscription *nats.Subscription, timeout time.Duration) (*nats.Msg, error) {
+	f.RLock()
+	ch, ok := f.syncSubscriptions[subscription]
+	f.RUnlock()
+
+	if !ok {
+		return nil, nats.ErrBadSubscription
+	}
+
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(timeout):
+		return nil, nats.ErrTimeout
+	}
+}
+
+func (f *FakeNATSConn) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msg, err := f.RequestWithContext(ctx, subject, data)
+	if err == context.DeadlineExceeded {
+		return nil, nats.ErrTimeout
+	}
+
+	return msg, err
+}
+
+func (f *FakeNATSConn) RequestWithContext(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	err := f.connectionError()
+	if err != nil {
+		return nil, err
+	}
+
+	f.RLock()
+	responders := len(f.matchingSubscriptions(subject))
+	f.RUnlock()
+
+	if responders == 0 {
+		return nil, nats.ErrNoResponders
+	}
+
+	f.Lock()
+	f.inboxCounter++
+	inbox := fmt.Sprintf("_INBOX.fake.%d", f.inboxCounter)
+	f.Unlock()
+
+	responses := make(chan *nats.Msg, 1)
+
+	subscription, err := f.Subscribe(inbox, func(msg *nats.Msg) {
+		select {
+		case responses <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer f.removeSubscriptionHandler(subscription)
+
+	// handlers run on their own goroutine so that a slow responder does
+	// not hold up the context
+	errs := make(chan error, 1)
+	go func() {
+		errs <- f.PublishRequest(subject, inbox, data)
+	}()
+
+	for {
+		select {
+		case msg := <-responses:
+			return msg, nil
+		case err := <-errs:
+			if err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// RespondTo subscribes responder to subject and delivers what it returns
+// to the reply subject of each message. Replies are not recorded in
+// PublishedMessages. A nil response sends no reply, so a Request waiting
+// for it times out.
+func (f *FakeNATSConn) RespondTo(subject string, responder func(*nats.Msg) []byte) (*nats.Subscription, error) {
+	return f.Subscribe(subject, func(msg *nats.Msg) {
+		response := responder(msg)
+		if response == nil || msg.Reply == "" {
+			return
+		}
+
+		f.deliver(&nats.Msg{Subject: msg.Reply, Data: response})
+	})
+}
+
+// deliver hands message to its recipients without recording it as
+// published.
+func (f *FakeNATSConn) deliver(message *nats.Msg) {
+	f.RLock()
+	callbacks := f.recipients(message.Subject)
+	f.RUnlock()
+
+	f.Lock()
+	f.stats.InMsgs += uint64(len(callbacks))
+	f.stats.InBytes += uint64(len(callbacks) * len(message.Data))
+	f.Unlock()
+
+	for _, cb := range callbacks {
+		cb(message)
+	}
+}
+
 func (f *FakeNATSConn) Unsubscribe(subscription *nats.Subscription) error {
 	f.Lock()
 	defer f.Unlock()
@@ -173,9 +573,61 @@ func (f *FakeNATSConn) addSubscriptionHandler(subscription *nats.Subscription, h
 		f.subscriptions[subscription.Subject] = subs
 	}
 	subs[subscription] = handler
+	f.nextSubscriptionID++
+	f.subscriptionIDs[subscription] = f.nextSubscriptionID
+	f.Unlock()
+}
+
+func (f *FakeNATSConn) removeSubscriptionHandler(subscription *nats.Subscription) {
+	f.Lock()
+	delete(f.subscriptions[subscription.Subject], subscription)
+	delete(f.subscriptionIDs, subscription)
+	if len(f.subscriptions[subscription.Subject]) == 0 {
+		delete(f.subscriptions, subscription.Subject)
+	}
 	f.Unlock()
 }
 
+// recipients returns the handlers a message on subject is delivered to:
+// every matching subscription outside a queue group and one member of each
+// matching queue group. Callers hold the lock.
+func (f *FakeNATSConn) recipients(subject string) []nats.MsgHandler {
+	matching := f.matchingSubscriptions(subject)
+
+	members := make([]queueMember[nats.MsgHandler], len(matching))
+	for i, sub := range matching {
+		members[i] = queueMember[nats.MsgHandler]{
+			subject: sub.Subject,
+			queue:   sub.Queue,
+			value:   f.subscriptions[sub.Subject][sub],
+		}
+	}
+
+	return selectRecipients(members, f.queueSelector)
+}
+
+// matchingSubscriptions returns the subscriptions matching subject in the
+// order they were made. Callers hold the lock.
+func (f *FakeNATSConn) matchingSubscriptions(subject string) []*nats.Subscription {
+	matching := []*nats.Subscription{}
+
+	for pattern, subs := range f.subscriptions {
+		if !yagnats.SubjectMatches(pattern, subject) {
+			continue
+		}
+
+		for sub := range subs {
+			matching = append(matching, sub)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return f.subscriptionIDs[matching[i]] < f.subscriptionIDs[matching[j]]
+	})
+
+	return matching
+}
+
 func (f *FakeNATSConn) WhenSubscribing(subject string, callback func(nats.MsgHandler) error) {
 	f.Lock()
 	f.whenSubscribing[subject] = callback
@@ -0,0 +1,350 @@
+package fakeyagnats
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+func TestFakeNATSConnRequest(t *testing.T) {
+	fake := Connect()
+
+	fake.Subscribe("greet", func(msg *nats.Msg) {
+		fake.Publish(msg.Reply, append([]byte("hello "), msg.Data...))
+	})
+
+	reply, err := fake.Request("greet", []byte("world"), time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(reply.Data) != "hello world" {
+		t.Errorf("unexpected reply: %q", reply.Data)
+	}
+
+	if fake.SubscriptionCount() != 1 {
+		t.Errorf("expected the reply inbox to be removed, have %d subscriptions", fake.SubscriptionCount())
+	}
+}
+
+func TestFakeNATSConnRequestErrors(t *testing.T) {
+	fake := Connect()
+
+	_, err := fake.Request("nobody.home", nil, time.Second)
+	if err != nats.ErrNoResponders {
+		t.Errorf("expected ErrNoResponders, got %v", err)
+	}
+
+	fake.Subscribe("silent", func(*nats.Msg) {})
+
+	_, err = fake.Request("silent", nil, 10*time.Millisecond)
+	if err != nats.ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = fake.RequestWithContext(ctx, "silent", nil)
+	if err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFakeNATSConnSubscribeSync(t *testing.T) {
+	fake := Connect()
+
+	sub, err := fake.SubscribeSync("foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fake.Publish("foo", []byte("bar"))
+
+	msg, err := fake.NextMsg(sub, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(msg.Data) != "bar" {
+		t.Errorf("unexpected message: %q", msg.Data)
+	}
+
+	_, err = fake.NextMsg(sub, 10*time.Millisecond)
+	if err != nats.ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestFakeNATSConnChanSubscribe(t *testing.T) {
+	fake := Connect()
+
+	ch := make(chan *nats.Msg, 1)
+	fake.ChanSubscribe("foo", ch)
+
+	fake.Publish("foo", []byte("bar"))
+
+	msg := <-ch
+	if string(msg.Data) != "bar" {
+		t.Errorf("unexpected message: %q", msg.Data)
+	}
+
+	stats := fake.Stats()
+	if stats.OutMsgs != 1 || stats.InMsgs != 1 || stats.OutBytes != 3 || stats.InBytes != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestFakeNATSConnStatus(t *testing.T) {
+	fake := Connect()
+
+	if fake.Status() != nats.CONNECTED {
+		t.Errorf("expected CONNECTED, got %v", fake.Status())
+	}
+
+	if fake.ConnectedUrl() == "" {
+		t.Error("expected a connected URL")
+	}
+
+	if err := fake.Flush(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if err := fake.Drain(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if fake.Status() != nats.CLOSED {
+		t.Errorf("expected CLOSED, got %v", fake.Status())
+	}
+
+	if fake.ConnectedUrl() != "" {
+		t.Errorf("expected no connected URL, got %q", fake.ConnectedUrl())
+	}
+
+	if err := fake.Flush(); err != nats.ErrConnectionClosed {
+		t.Errorf("expected ErrConnectionClosed, got %v", err)
+	}
+}
+
+func TestFakeNATSConnSimulateAsyncError(t *testing.T) {
+	fake := Connect()
+
+	sub, _ := fake.Subscribe("foo", func(*nats.Msg) {})
+
+	var calls []string
+	fake.AddErrorCB(func(_ *nats.Conn, s *nats.Subscription, err error) {
+		if s != sub || err != nats.ErrSlowConsumer {
+			t.Errorf("unexpected callback arguments: %v %v", s, err)
+		}
+		calls = append(calls, "first")
+	})
+	remove := fake.AddErrorCB(func(*nats.Conn, *nats.Subscription, error) {
+		calls = append(calls, "removed")
+	})
+	fake.AddErrorCB(func(*nats.Conn, *nats.Subscription, error) {
+		calls = append(calls, "last")
+	})
+
+	remove()
+	fake.SimulateAsyncError(sub, nats.ErrSlowConsumer)
+
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "last" {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+
+	if fake.LastError() != nats.ErrSlowConsumer {
+		t.Errorf("expected LastError to be ErrSlowConsumer, got %v", fake.LastError())
+	}
+}
+
+func TestFakeNATSConnSimulateDisconnectAndReconnect(t *testing.T) {
+	fake := Connect()
+
+	var events []string
+	fake.AddDisconnectedCB(func(*nats.Conn) { events = append(events, "disconnected") })
+	fake.AddReconnectedCB(func(*nats.Conn) { events = append(events, "reconnected 1") })
+	fake.AddReconnectedCB(func(*nats.Conn) { events = append(events, "reconnected 2") })
+
+	fake.SimulateDisconnect()
+
+	if fake.Ping() {
+		t.Error("expected Ping to fail while disconnected")
+	}
+
+	if err := fake.Publish("foo", []byte("bar")); err != nats.ErrConnectionReconnecting {
+		t.Errorf("expected ErrConnectionReconnecting, got %v", err)
+	}
+
+	fake.SimulateReconnect()
+
+	if !fake.Ping() {
+		t.Error("expected Ping to succeed after reconnecting")
+	}
+
+	if err := fake.Publish("foo", []byte("bar")); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if fake.Stats().Reconnects != 1 {
+		t.Errorf("expected 1 reconnect, got %d", fake.Stats().Reconnects)
+	}
+
+	expected := []string{"disconnected", "reconnected 1", "reconnected 2"}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+}
+
+func TestFakeNATSConnSimulateClose(t *testing.T) {
+	fake := Connect()
+
+	var events []string
+	fake.AddDisconnectedCB(func(*nats.Conn) { events = append(events, "disconnected") })
+	remove := fake.AddClosedCB(func(*nats.Conn) { events = append(events, "removed") })
+	fake.AddClosedCB(func(*nats.Conn) { events = append(events, "closed") })
+
+	remove()
+	fake.SimulateClose()
+	fake.SimulateClose()
+
+	expected := []string{"disconnected", "closed"}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, events)
+	}
+
+	if err := fake.Publish("foo", []byte("bar")); err != nats.ErrConnectionClosed {
+		t.Errorf("expected ErrConnectionClosed, got %v", err)
+	}
+}
+
+func TestFakeNATSConnDeliversToWildcardSubscriptions(t *testing.T) {
+	fake := Connect()
+
+	received := []string{}
+	fake.Subscribe("foo.*", func(msg *nats.Msg) {
+		received = append(received, "foo.* "+msg.Subject)
+	})
+	fake.Subscribe("foo.>", func(msg *nats.Msg) {
+		received = append(received, "foo.> "+msg.Subject)
+	})
+
+	fake.Publish("foo.bar.baz", []byte("hi"))
+	fake.Publish("bar", []byte("hi"))
+
+	if len(received) != 1 || received[0] != "foo.> foo.bar.baz" {
+		t.Errorf("expected only foo.> to receive foo.bar.baz, got %v", received)
+	}
+
+	received = nil
+	fake.Publish("foo.bar", []byte("hi"))
+
+	if len(received) != 2 {
+		t.Errorf("expected both subscriptions to receive foo.bar, got %v", received)
+	}
+
+	fake.Subscribe("svc.>", func(msg *nats.Msg) {
+		fake.Publish(msg.Reply, []byte("pong"))
+	})
+
+	response, err := fake.Request("svc.ping", nil, time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(response.Data) != "pong" {
+		t.Errorf("expected pong, got %q", response.Data)
+	}
+}
+
+func TestFakeNATSConnDeliversToOneQueueMember(t *testing.T) {
+	fake := Connect()
+	fake.SetQueueSelector(FirstQueueMember)
+
+	received := []string{}
+	subscribe := func(name, subject, queue string) {
+		fake.QueueSubscribe(subject, queue, func(*nats.Msg) {
+			received = append(received, name)
+		})
+	}
+
+	subscribe("a-1", "foo", "a")
+	subscribe("a-2", "foo", "a")
+	subscribe("b-1", "foo", "b")
+	subscribe("wildcard-a", "foo.>", "a")
+	subscribe("plain", "foo", "")
+
+	fake.Publish("foo", []byte("hi"))
+
+	expected := []string{"plain", "a-1", "b-1"}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+
+	if fake.Stats().InMsgs != 3 {
+		t.Errorf("expected 3 delivered messages, got %d", fake.Stats().InMsgs)
+	}
+}
+
+func TestFakeNATSConnRespondTo(t *testing.T) {
+	fake := Connect()
+
+	fake.RespondTo("greet", func(msg *nats.Msg) []byte {
+		return append([]byte("hello "), msg.Data...)
+	})
+
+	response, err := fake.Request("greet", []byte("world"), time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(response.Data) != "hello world" {
+		t.Errorf("expected 'hello world', got %q", response.Data)
+	}
+
+	if fake.PublishedMessageCount() != 1 {
+		t.Errorf("expected only the request to be published, got %d messages", fake.PublishedMessageCount())
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	fake.RespondTo("slow", func(*nats.Msg) []byte {
+		<-release
+		return []byte("too late")
+	})
+
+	_, err = fake.Request("slow", nil, 50*time.Millisecond)
+	if err != nats.ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
+
+func TestFakeNATSConnRequestAdvancesQueueSelectorOnce(t *testing.T) {
+	fake := Connect()
+	fake.SetQueueSelector(RoundRobinQueueSelector())
+
+	for _, name := range []string{"a", "b"} {
+		name := name
+		fake.QueueSubscribe("work", "workers", func(msg *nats.Msg) {
+			fake.PublishRequest(msg.Reply, "", []byte(name))
+		})
+	}
+
+	received := []string{}
+	for i := 0; i < 4; i++ {
+		response, err := fake.Request("work", nil, time.Second)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		received = append(received, string(response.Data))
+	}
+
+	if fmt.Sprint(received) != "[a b a b]" {
+		t.Errorf("expected the queue members in turn, got %v", received)
+	}
+}
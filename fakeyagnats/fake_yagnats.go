@@ -1,9 +1,13 @@
 package fakeyagnats
 
 import (
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/cloudfoundry/yagnats"
+	nats "github.com/nats-io/nats.go"
 )
 
 type FakeYagnats struct {
@@ -28,6 +32,9 @@ type FakeYagnats struct {
 	pingResponse bool
 
 	nextSubscriptionID int64
+	inboxCounter       int
+
+	queueSelector QueueSelector
 
 	sync.RWMutex
 }
@@ -58,6 +65,17 @@ func (f *FakeYagnats) Reset() {
 	f.pingResponse = true
 
 	f.nextSubscriptionID = 0
+	f.inboxCounter = 0
+
+	f.queueSelector = RandomQueueSelector(time.Now().UnixNano())
+}
+
+// SetQueueSelector sets how the member of a queue group that receives a
+// message is picked. It defaults to RandomQueueSelector.
+func (f *FakeYagnats) SetQueueSelector(selector QueueSelector) {
+	f.Lock()
+	f.queueSelector = selector
+	f.Unlock()
 }
 
 func (f *FakeYagnats) OnPing(onPingCallback func() bool) {
@@ -127,11 +145,7 @@ func (f *FakeYagnats) PublishWithReplyTo(subject, reply string, payload []byte)
 		Payload: payload,
 	}
 
-	var callback yagnats.Callback
-
-	if len(f.subscriptions[subject]) > 0 {
-		callback = f.subscriptions[subject][0].Callback
-	}
+	callbacks := f.recipients(subject)
 
 	f.RUnlock()
 
@@ -146,13 +160,61 @@ func (f *FakeYagnats) PublishWithReplyTo(subject, reply string, payload []byte)
 	f.publishedMessages[subject] = append(f.publishedMessages[subject], *message)
 	f.Unlock()
 
-	if callback != nil {
+	for _, callback := range callbacks {
 		callback(message)
 	}
 
 	return nil
 }
 
+// deliver hands message to its recipients without recording it as
+// published, for replies sent by RespondTo.
+func (f *FakeYagnats) deliver(message *yagnats.Message) {
+	f.RLock()
+	callbacks := f.recipients(message.Subject)
+	f.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(message)
+	}
+}
+
+// matchingSubscriptions returns the subscriptions matching subject in the
+// order they were made. Callers hold the lock.
+func (f *FakeYagnats) matchingSubscriptions(subject string) []yagnats.Subscription {
+	matching := []yagnats.Subscription{}
+
+	for pattern, subscriptions := range f.subscriptions {
+		if yagnats.SubjectMatches(pattern, subject) {
+			matching = append(matching, subscriptions...)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].ID < matching[j].ID
+	})
+
+	return matching
+}
+
+// recipients returns the callbacks a message on subject is delivered to:
+// every matching subscription outside a queue group and one member of each
+// matching queue group. Callers hold the lock.
+func (f *FakeYagnats) recipients(subject string) []yagnats.Callback {
+	matching := f.matchingSubscriptions(subject)
+
+	members := make([]queueMember[yagnats.Callback], len(matching))
+	for i, subscription := range matching {
+		members[i] = queueMember[yagnats.Callback]{
+			subject: subscription.Subject,
+			queue:   subscription.Queue,
+			value:   subscription.Callback,
+		}
+	}
+
+	return selectRecipients(members, f.queueSelector)
+}
+
 func (f *FakeYagnats) Subscribe(subject string, callback yagnats.Callback) (int64, error) {
 	return f.SubscribeWithQueue(subject, "", callback)
 }
@@ -188,6 +250,91 @@ func (f *FakeYagnats) SubscribeWithQueue(subject, queue string, callback yagnats
 	return subscription.ID, nil
 }
 
+// RespondTo subscribes responder to subject and delivers what it returns
+// to the reply subject of each message. Replies are not recorded in
+// PublishedMessages. A nil response sends no reply, so a Request waiting
+// for it times out.
+func (f *FakeYagnats) RespondTo(subject string, responder func(*yagnats.Message) []byte) (int64, error) {
+	return f.Subscribe(subject, func(msg *yagnats.Message) {
+		response := responder(msg)
+		if response == nil || msg.ReplyTo == "" {
+			return
+		}
+
+		f.deliver(&yagnats.Message{Subject: msg.ReplyTo, Payload: response})
+	})
+}
+
+// Request publishes payload with a fresh inbox as reply subject and waits
+// for the first reply. It fails with nats.ErrNoResponders when nothing is
+// subscribed to subject and with nats.ErrTimeout when no reply arrives in
+// time. Subscribers run on their own goroutine so that a slow one does not
+// hold up the timeout.
+func (f *FakeYagnats) Request(subject string, payload []byte, timeout time.Duration) (*yagnats.Message, error) {
+	f.Lock()
+	responders := len(f.matchingSubscriptions(subject))
+
+	f.inboxCounter++
+	inbox := fmt.Sprintf("_INBOX.fake.%d", f.inboxCounter)
+	f.Unlock()
+
+	if responders == 0 {
+		return nil, nats.ErrNoResponders
+	}
+
+	responses := make(chan *yagnats.Message, 1)
+
+	sid, err := f.Subscribe(inbox, func(msg *yagnats.Message) {
+		select {
+		case responses <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer f.removeSubscription(inbox, sid)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- f.PublishWithReplyTo(subject, inbox, payload)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case msg := <-responses:
+			return msg, nil
+		case err := <-errs:
+			if err != nil {
+				return nil, err
+			}
+		case <-timer.C:
+			return nil, nats.ErrTimeout
+		}
+	}
+}
+
+func (f *FakeYagnats) removeSubscription(subject string, sid int64) {
+	f.Lock()
+	defer f.Unlock()
+
+	subscriptions := []yagnats.Subscription{}
+	for _, subscription := range f.subscriptions[subject] {
+		if subscription.ID != sid {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	if len(subscriptions) == 0 {
+		delete(f.subscriptions, subject)
+	} else {
+		f.subscriptions[subject] = subscriptions
+	}
+}
+
 func (f *FakeYagnats) Unsubscribe(subscription int64) error {
 	f.Lock()
 	defer f.Unlock()
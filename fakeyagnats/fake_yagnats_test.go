@@ -1,9 +1,12 @@
 package fakeyagnats
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/cloudfoundry/yagnats"
+	nats "github.com/nats-io/nats.go"
 )
 
 func FunctionTakingNATSClient(yagnats.NATSClient) {
@@ -21,3 +24,98 @@ func TestCanPassFakeYagnatsAsNATSClient(t *testing.T) {
 func TestCanPassFakeYagnatsAsNatsDotConn(t *testing.T) {
 	FunctionTakingNatsConn(Connect())
 }
+
+func TestFakeYagnatsDeliversToWildcardSubscriptions(t *testing.T) {
+	fake := New()
+
+	received := []string{}
+	fake.Subscribe("router.*", func(msg *yagnats.Message) {
+		received = append(received, msg.Subject)
+	})
+
+	fake.Publish("router.register", []byte("hi"))
+	fake.Publish("router.register.extra", []byte("hi"))
+	fake.Publish("other.register", []byte("hi"))
+
+	if len(received) != 1 || received[0] != "router.register" {
+		t.Errorf("expected only router.register to be delivered, got %v", received)
+	}
+}
+
+func TestFakeYagnatsDeliversToOneQueueMember(t *testing.T) {
+	fake := New()
+	fake.SetQueueSelector(RoundRobinQueueSelector())
+
+	received := []string{}
+	subscribe := func(name, queue string) {
+		fake.SubscribeWithQueue("foo", queue, func(*yagnats.Message) {
+			received = append(received, name)
+		})
+	}
+
+	subscribe("plain-1", "")
+	subscribe("queue-1", "workers")
+	subscribe("queue-2", "workers")
+	subscribe("plain-2", "")
+
+	fake.Publish("foo", []byte("one"))
+	fake.Publish("foo", []byte("two"))
+
+	expected := []string{"plain-1", "plain-2", "queue-1", "plain-1", "plain-2", "queue-2"}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+}
+
+func TestFakeYagnatsRespondTo(t *testing.T) {
+	fake := New()
+
+	fake.RespondTo("greet.*", func(msg *yagnats.Message) []byte {
+		return append([]byte("hello "), msg.Payload...)
+	})
+
+	response, err := fake.Request("greet.en", []byte("world"), time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(response.Payload) != "hello world" {
+		t.Errorf("expected 'hello world', got %q", response.Payload)
+	}
+
+	if len(fake.Subscriptions(response.Subject)) != 0 {
+		t.Error("expected the inbox subscription to be removed")
+	}
+
+	if fake.PublishedMessageCount() != 1 {
+		t.Errorf("expected only the request to be published, got %d messages", fake.PublishedMessageCount())
+	}
+}
+
+func TestFakeYagnatsRequestErrors(t *testing.T) {
+	fake := New()
+
+	_, err := fake.Request("nobody.home", nil, time.Second)
+	if err != nats.ErrNoResponders {
+		t.Errorf("expected ErrNoResponders, got %v", err)
+	}
+
+	fake.RespondTo("silent", func(*yagnats.Message) []byte {
+		return nil
+	})
+
+	release := make(chan struct{})
+	defer close(release)
+
+	fake.RespondTo("slow", func(*yagnats.Message) []byte {
+		<-release
+		return []byte("too late")
+	})
+
+	for _, subject := range []string{"silent", "slow"} {
+		_, err = fake.Request(subject, nil, 50*time.Millisecond)
+		if err != nats.ErrTimeout {
+			t.Errorf("expected ErrTimeout from %s, got %v", subject, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package fakeyagnats
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// QueueSelector picks which of the members of a queue group receives a
+// message, returning an index below members. Members are ordered by when
+// they subscribed.
+type QueueSelector func(queue string, members int) int
+
+// RandomQueueSelector picks members at random, as the server does. The same
+// seed gives the same sequence of picks.
+func RandomQueueSelector(seed int64) QueueSelector {
+	random := rand.New(rand.NewSource(seed))
+	lock := &sync.Mutex{}
+
+	return func(queue string, members int) int {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return random.Intn(members)
+	}
+}
+
+// RoundRobinQueueSelector picks the members of each queue group in turn.
+func RoundRobinQueueSelector() QueueSelector {
+	next := map[string]int{}
+	lock := &sync.Mutex{}
+
+	return func(queue string, members int) int {
+		lock.Lock()
+		defer lock.Unlock()
+
+		member := next[queue] % members
+		next[queue] = member + 1
+
+		return member
+	}
+}
+
+// FirstQueueMember always picks the member that subscribed first.
+func FirstQueueMember(queue string, members int) int {
+	return 0
+}
+
+type queueMember[T any] struct {
+	subject string
+	queue   string
+	value   T
+}
+
+// selectRecipients returns every member outside a queue group and one
+// member of each queue group. A queue group is the members sharing both
+// subscription subject and queue name.
+func selectRecipients[T any](members []queueMember[T], selector QueueSelector) []T {
+	type groupKey struct{ subject, queue string }
+
+	recipients := []T{}
+	groups := map[groupKey][]T{}
+	order := []groupKey{}
+
+	for _, member := range members {
+		if member.queue == "" {
+			recipients = append(recipients, member.value)
+			continue
+		}
+
+		key := groupKey{member.subject, member.queue}
+		if _, found := groups[key]; !found {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], member.value)
+	}
+
+	for _, key := range order {
+		group := groups[key]
+		recipients = append(recipients, group[selector(key.queue, len(group))])
+	}
+
+	return recipients
+}
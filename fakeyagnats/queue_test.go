@@ -0,0 +1,36 @@
+package fakeyagnats
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRandomQueueSelectorIsReproducible(t *testing.T) {
+	first := RandomQueueSelector(42)
+	second := RandomQueueSelector(42)
+
+	for i := 0; i < 20; i++ {
+		a, b := first("workers", 5), second("workers", 5)
+		if a != b {
+			t.Fatalf("expected the same pick from the same seed, got %d and %d", a, b)
+		}
+
+		if a < 0 || a >= 5 {
+			t.Fatalf("pick %d is out of range", a)
+		}
+	}
+}
+
+func TestRoundRobinQueueSelectorCyclesPerQueue(t *testing.T) {
+	selector := RoundRobinQueueSelector()
+
+	picks := []int{
+		selector("a", 3), selector("a", 3), selector("b", 3),
+		selector("a", 3), selector("a", 3),
+	}
+
+	expected := []int{0, 1, 0, 2, 0}
+	if fmt.Sprint(picks) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, picks)
+	}
+}
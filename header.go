@@ -0,0 +1,102 @@
+package yagnats
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const headerVersionLine = "NATS/1.0"
+
+var ErrHeadersNotSupported = errors.New("server does not support headers")
+
+type Header map[string][]string
+
+type headerFallbackKey struct{}
+
+// WithHeaderFallback returns a context for Message.WithContext that makes
+// Client fold a message's headers into its payload with fold, rather than
+// fail with ErrHeadersNotSupported, when the connection it is published on
+// has no header support.
+func WithHeaderFallback(ctx context.Context, fold func(header Header, payload []byte) []byte) context.Context {
+	return context.WithValue(ctx, headerFallbackKey{}, fold)
+}
+
+func headerFallback(ctx context.Context) (func(Header, []byte) []byte, bool) {
+	fold, ok := ctx.Value(headerFallbackKey{}).(func(Header, []byte) []byte)
+	return fold, ok
+}
+
+func (h Header) Get(key string) string {
+	values := h[key]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func (h Header) Set(key, value string) {
+	h[key] = []string{value}
+}
+
+func (h Header) Add(key, value string) {
+	h[key] = append(h[key], value)
+}
+
+func (h Header) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (h Header) encode() []byte {
+	buf := new(bytes.Buffer)
+
+	buf.WriteString(headerVersionLine + "\r\n")
+
+	for _, key := range h.Keys() {
+		for _, value := range h[key] {
+			fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+		}
+	}
+
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+func parseHeader(data []byte) (Header, error) {
+	lines := bufio.NewScanner(bytes.NewReader(data))
+
+	if !lines.Scan() || !strings.HasPrefix(lines.Text(), headerVersionLine) {
+		return nil, errors.New("Malformed header block")
+	}
+
+	header := Header{}
+
+	for lines.Scan() {
+		line := lines.Text()
+		if line == "" {
+			break
+		}
+
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, errors.New("Malformed header line")
+		}
+
+		header.Add(line[:colon], strings.TrimSpace(line[colon+1:]))
+	}
+
+	return header, nil
+}
@@ -2,13 +2,15 @@ package yagnats
 
 import (
 	"bytes"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
-	"os/exec"
-	"strconv"
 	"sync"
 	"time"
+
+	"github.com/cloudfoundry/yagnats/internal/natsserver"
+	"github.com/nats-io/nats-server/v2/server"
 )
 
 type FakeConnectionProvider struct {
@@ -60,51 +62,56 @@ func (c *DisconnectingConnectionProvider) ProvideConnection() (*Connection, erro
 	return connection, nil
 }
 
-func startNats(port int) *exec.Cmd {
-	cmd := exec.Command("gnatsd", "-p", strconv.Itoa(port), "--user", "nats", "--pass", "nats")
-	err := cmd.Start()
-	if err != nil {
-		fmt.Printf("NATS failed to start: %v\n", err)
-	}
-	err = waitUntilNatsUp(port)
-	if err != nil {
-		panic("Cannot connect to NATS")
-	}
-	return cmd
+func startNats(port int) *server.Server {
+	return startNatsWithOptions(&server.Options{Port: port})
 }
 
-func startNatsTLS(port int) *exec.Cmd {
-	cmd := exec.Command("gnatsd", "-p", strconv.Itoa(port), "--user", "nats", "--pass", "nats", "--tls", "--tlscert", "./assets/server-cert.pem", "--tlskey", "./assets/server-pkey.pem")
-	err := cmd.Start()
-	if err != nil {
-		fmt.Printf("NATS failed to start: %v\n", err)
+func startNatsTLS(port int) *server.Server {
+	return startNatsWithOptions(&server.Options{Port: port, TLSConfig: serverTLSConfig(false)})
+}
+
+func startNatsMutualTLS(port int) *server.Server {
+	return startNatsWithOptions(&server.Options{Port: port, TLSConfig: serverTLSConfig(true), TLSVerify: true})
+}
+
+func startNatsTLSHandshakeFirst(port int) *server.Server {
+	return startNatsWithOptions(&server.Options{Port: port, TLSConfig: serverTLSConfig(false), TLSHandshakeFirst: true})
+}
+
+func startNatsWithOptions(opts *server.Options) *server.Server {
+	opts.Host = "127.0.0.1"
+	opts.Username = "nats"
+	opts.Password = "nats"
+
+	if opts.TLSConfig != nil {
+		opts.TLS = true
+		opts.TLSTimeout = 2
 	}
 
-	err = waitUntilNatsUp(port)
+	s, err := natsserver.Start(opts)
 	if err != nil {
+		fmt.Printf("NATS failed to start: %v\n", err)
 		panic("Cannot connect to NATS")
 	}
-	return cmd
+	return s
 }
 
-func startNatsMutualTLS(port int) *exec.Cmd {
-	cmd := exec.Command("gnatsd", "-p", strconv.Itoa(port), "--user", "nats", "--pass", "nats", "--tls", "--tlscert", "./assets/server-cert.pem", "--tlskey", "./assets/server-pkey.pem", "--tlsverify", "--tlscacert", "./assets/ca.pem")
-	err := cmd.Start()
+func serverTLSConfig(verify bool) *tls.Config {
+	config, err := natsserver.TLSConfig(verify)
 	if err != nil {
-		fmt.Printf("NATS failed to start: %v\n", err)
+		panic(err)
 	}
+	return config
+}
 
-	err = waitUntilNatsUp(port)
-
-	if err != nil {
-		panic("Cannot connect to NATS")
-	}
-	return cmd
+func stopNats(s *server.Server) {
+	s.Shutdown()
+	s.WaitForShutdown()
 }
 
-func stopCmd(cmd *exec.Cmd) {
-	cmd.Process.Kill()
-	cmd.Wait()
+// lameDuck puts the server into lame duck mode, like SIGUSR2 does.
+func lameDuck(s *server.Server) {
+	go s.LameDuckShutdown()
 }
 
 func waitUntilNatsUp(port int) error {
@@ -0,0 +1,80 @@
+// Package natsserver runs nats-server inside the test process, so the tests
+// do not need a nats-server binary on the PATH.
+package natsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/yagnats/assets"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+var ErrNotReady = errors.New("nats-server did not become ready")
+
+var errInvalidCA = errors.New("no certificates found in ca.pem")
+
+const readyTimeout = 10 * time.Second
+
+// Start starts a server with opts and waits until it accepts clients.
+func Start(opts *server.Options) (*server.Server, error) {
+	opts.NoLog = true
+	opts.NoSigs = true
+
+	s, err := server.NewServer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	go s.Start()
+
+	if !s.ReadyForConnections(readyTimeout) {
+		s.Shutdown()
+		return nil, ErrNotReady
+	}
+
+	return s, nil
+}
+
+// TLSConfig serves the embedded server certificate. With verify set, clients
+// must present a certificate signed by the embedded CA.
+func TLSConfig(verify bool) (*tls.Config, error) {
+	certPEM, err := assets.FS.ReadFile("server-cert.pem")
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := assets.FS.ReadFile("server-pkey.pem")
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if verify {
+		caPEM, err := assets.FS.ReadFile("ca.pem")
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errInvalidCA
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
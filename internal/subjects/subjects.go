@@ -0,0 +1,44 @@
+// Package subjects checks subjects the way nats-server does, for the client
+// and for the in-memory test server.
+package subjects
+
+import "strings"
+
+// Valid reports whether nats-server accepts subject in a SUB: its tokens are
+// non-empty and free of whitespace, wildcards are whole tokens, and ">" only
+// ends it.
+func Valid(subject string) bool {
+	tokens := strings.Split(subject, ".")
+
+	for i, token := range tokens {
+		if token == "" || strings.ContainsAny(token, " \t\r\n") {
+			return false
+		}
+
+		if token == ">" && i != len(tokens)-1 {
+			return false
+		}
+
+		if len(token) > 1 && strings.ContainsAny(token, "*>") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidForPublish reports whether nats-server accepts subject in a PUB: it
+// is valid and has no wildcards.
+func ValidForPublish(subject string) bool {
+	if !Valid(subject) {
+		return false
+	}
+
+	for _, token := range strings.Split(subject, ".") {
+		if token == "*" || token == ">" {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,38 @@
+package subjects
+
+import "testing"
+
+func TestValid(t *testing.T) {
+	for subject, valid := range map[string]bool{
+		"foo.bar": true,
+		"foo.*":   true,
+		"foo.>":   true,
+		">":       true,
+
+		"":         false,
+		"foo..bar": false,
+		"foo bar":  false,
+		">.a":      false,
+		"foo.b*":   false,
+	} {
+		if Valid(subject) != valid {
+			t.Errorf("expected Valid(%q) to be %v", subject, valid)
+		}
+	}
+}
+
+func TestValidForPublish(t *testing.T) {
+	for subject, valid := range map[string]bool{
+		"foo.bar":    true,
+		"_INBOX.abc": true,
+
+		"foo.*":    false,
+		"foo.>":    false,
+		"foo..bar": false,
+		"foo.b*":   false,
+	} {
+		if ValidForPublish(subject) != valid {
+			t.Errorf("expected ValidForPublish(%q) to be %v", subject, valid)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package logadapter
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/cloudfoundry/yagnats"
+)
+
+// NewLager logs through l. lager has no warn level, so warnings are logged as
+// info, and its Fatal panics, so fatal messages are logged as errors. An
+// "error" entry in the data becomes the error lager logs.
+func NewLager(l lager.Logger, level Level) yagnats.Logger {
+	return newLogger(level, func(level Level, message string, data map[string]interface{}) {
+		switch level {
+		case LevelDebug:
+			l.Debug(message, lager.Data(data))
+		case LevelInfo, LevelWarn:
+			l.Info(message, lager.Data(data))
+		default:
+			err, data := splitError(data)
+			l.Error(message, err, lager.Data(data))
+		}
+	})
+}
+
+func splitError(data map[string]interface{}) (error, map[string]interface{}) {
+	message, ok := data["error"].(string)
+	if !ok {
+		return nil, data
+	}
+
+	rest := make(map[string]interface{}, len(data)-1)
+	for key, value := range data {
+		if key != "error" {
+			rest[key] = value
+		}
+	}
+
+	return errors.New(message), rest
+}
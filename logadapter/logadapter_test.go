@@ -0,0 +1,152 @@
+package logadapter
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/lager/v3"
+	"github.com/sirupsen/logrus"
+)
+
+func TestSlogAdapter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	handler := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+
+	logger := NewSlog(slog.New(handler), LevelInfo)
+
+	logger.Debugd(map[string]interface{}{"a": 1}, "client.ignored")
+	logger.Warnd(map[string]interface{}{"packet": "PING"}, "connection.packet.sent")
+	logger.Fatal("client.fatal")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	entry := map[string]interface{}{}
+	json.Unmarshal([]byte(lines[0]), &entry)
+
+	if entry["msg"] != "connection.packet.sent" || entry["level"] != "WARN" || entry["packet"] != "PING" {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+
+	json.Unmarshal([]byte(lines[1]), &entry)
+
+	if entry["level"] != "ERROR+4" {
+		t.Fatalf("expected fatal above error, got %v", entry["level"])
+	}
+}
+
+func TestSlogAdapterRespectsHandlerLevel(t *testing.T) {
+	buf := new(bytes.Buffer)
+	handler := slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelError})
+
+	NewSlogHandler(handler, LevelDebug).Info("client.ignored")
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be logged, got %q", buf.String())
+	}
+}
+
+type lagerSink struct {
+	logs []lager.LogFormat
+}
+
+func (s *lagerSink) Log(log lager.LogFormat) {
+	s.logs = append(s.logs, log)
+}
+
+func TestLagerAdapter(t *testing.T) {
+	sink := &lagerSink{}
+	l := lager.NewLogger("test")
+	l.RegisterSink(sink)
+
+	logger := NewLager(l, LevelDebug)
+
+	logger.Debugd(map[string]interface{}{"a": 1}, "debug")
+	logger.Warn("warn")
+	logger.Fatal("fatal")
+
+	if len(sink.logs) != 3 {
+		t.Fatalf("expected 3 logs, got %d", len(sink.logs))
+	}
+
+	expected := []lager.LogLevel{lager.DEBUG, lager.INFO, lager.ERROR}
+	for i, log := range sink.logs {
+		if log.LogLevel != expected[i] {
+			t.Errorf("log %d: expected level %v, got %v", i, expected[i], log.LogLevel)
+		}
+	}
+
+	if sink.logs[0].Message != "test.debug" || sink.logs[0].Data["a"] != 1 {
+		t.Fatalf("unexpected log: %v", sink.logs[0])
+	}
+
+	if sink.logs[2].Error != nil || sink.logs[2].Data["error"] != nil {
+		t.Fatalf("expected no error without error data, got %v", sink.logs[2])
+	}
+
+	logger.Errord(map[string]interface{}{"error": "boom"}, "connection.packet.read-failed")
+
+	failed := sink.logs[3]
+	if failed.Error == nil || failed.Error.Error() != "boom" || failed.Data["error"] != "boom" {
+		t.Fatalf("expected the error from the data, got %v", failed)
+	}
+}
+
+func TestLogrusAdapter(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	l := logrus.New()
+	l.Out = buf
+	l.Level = logrus.DebugLevel
+	l.Formatter = &logrus.JSONFormatter{}
+
+	logger := NewLogrus(l, LevelWarn)
+
+	logger.Info("ignored")
+	logger.Errord(map[string]interface{}{"a": "b"}, "connection.packet.read-failed")
+	logger.Fatal("client.fatal")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+
+	entry := map[string]interface{}{}
+	json.Unmarshal([]byte(lines[0]), &entry)
+
+	if entry["msg"] != "connection.packet.read-failed" || entry["level"] != "error" || entry["a"] != "b" {
+		t.Fatalf("unexpected entry: %v", entry)
+	}
+}
+
+func TestStdAdapter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewStd(log.New(buf, "", 0), LevelInfo)
+
+	logger.Debug("ignored")
+	logger.Infod(map[string]interface{}{"b": 2, "a": 1}, "client.connected")
+	logger.Fatal("client.fatal")
+
+	expected := "[info] client.connected a=1 b=2\n[fatal] client.fatal\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, ok := ParseLevel("WARN")
+	if !ok || level != LevelWarn {
+		t.Fatalf("expected warn, got %v %v", level, ok)
+	}
+
+	_, ok = ParseLevel("verbose")
+	if ok {
+		t.Fatal("expected unknown level to fail")
+	}
+}
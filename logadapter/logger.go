@@ -0,0 +1,91 @@
+package logadapter
+
+import (
+	"strings"
+
+	"github.com/cloudfoundry/yagnats"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	case LevelFatal:
+		return "fatal"
+	}
+
+	return "unknown"
+}
+
+func ParseLevel(level string) (Level, bool) {
+	for l := LevelDebug; l <= LevelFatal; l++ {
+		if strings.EqualFold(level, l.String()) {
+			return l, true
+		}
+	}
+
+	return LevelDebug, false
+}
+
+type sink func(level Level, message string, data map[string]interface{})
+
+// logger implements yagnats.Logger on top of a sink, dropping anything below
+// its minimum level. Fatal is logged like any other level; it never exits.
+type logger struct {
+	level Level
+	sink  sink
+}
+
+func newLogger(level Level, sink sink) yagnats.Logger {
+	return &logger{level: level, sink: sink}
+}
+
+func (l *logger) log(level Level, message string, data map[string]interface{}) {
+	if level < l.level {
+		return
+	}
+
+	l.sink(level, message, data)
+}
+
+func (l *logger) Fatal(message string) { l.log(LevelFatal, message, nil) }
+func (l *logger) Error(message string) { l.log(LevelError, message, nil) }
+func (l *logger) Warn(message string)  { l.log(LevelWarn, message, nil) }
+func (l *logger) Info(message string)  { l.log(LevelInfo, message, nil) }
+func (l *logger) Debug(message string) { l.log(LevelDebug, message, nil) }
+
+func (l *logger) Fatald(data map[string]interface{}, message string) {
+	l.log(LevelFatal, message, data)
+}
+
+func (l *logger) Errord(data map[string]interface{}, message string) {
+	l.log(LevelError, message, data)
+}
+
+func (l *logger) Warnd(data map[string]interface{}, message string) {
+	l.log(LevelWarn, message, data)
+}
+
+func (l *logger) Infod(data map[string]interface{}, message string) {
+	l.log(LevelInfo, message, data)
+}
+
+func (l *logger) Debugd(data map[string]interface{}, message string) {
+	l.log(LevelDebug, message, data)
+}
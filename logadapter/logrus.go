@@ -0,0 +1,25 @@
+package logadapter
+
+import (
+	"github.com/cloudfoundry/yagnats"
+	"github.com/sirupsen/logrus"
+)
+
+// NewLogrus logs through l. logrus exits on Fatal, so fatal messages are
+// logged at error level.
+func NewLogrus(l logrus.FieldLogger, level Level) yagnats.Logger {
+	return newLogger(level, func(level Level, message string, data map[string]interface{}) {
+		entry := l.WithFields(logrus.Fields(data))
+
+		switch level {
+		case LevelDebug:
+			entry.Debug(message)
+		case LevelInfo:
+			entry.Info(message)
+		case LevelWarn:
+			entry.Warn(message)
+		default:
+			entry.Error(message)
+		}
+	})
+}
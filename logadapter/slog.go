@@ -0,0 +1,59 @@
+package logadapter
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+)
+
+// SlogLevelFatal sits above slog.LevelError, which is the highest level slog
+// defines.
+const SlogLevelFatal = slog.LevelError + 4
+
+func NewSlog(l *slog.Logger, level Level) yagnats.Logger {
+	return NewSlogHandler(l.Handler(), level)
+}
+
+func NewSlogHandler(handler slog.Handler, level Level) yagnats.Logger {
+	return newLogger(level, func(level Level, message string, data map[string]interface{}) {
+		ctx := context.Background()
+		slogLevel := slogLevel(level)
+
+		if !handler.Enabled(ctx, slogLevel) {
+			return
+		}
+
+		record := slog.NewRecord(time.Now(), slogLevel, message, 0)
+
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			record.AddAttrs(slog.Any(key, data[key]))
+		}
+
+		handler.Handle(ctx, record)
+	})
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+
+	return SlogLevelFatal
+}
@@ -0,0 +1,29 @@
+package logadapter
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry/yagnats"
+)
+
+// NewStd writes lines like "[error] message key=value" to l.
+func NewStd(l *log.Logger, level Level) yagnats.Logger {
+	return newLogger(level, func(level Level, message string, data map[string]interface{}) {
+		fields := make([]string, 0, len(data))
+		for key, value := range data {
+			fields = append(fields, fmt.Sprintf("%s=%v", key, value))
+		}
+
+		sort.Strings(fields)
+
+		line := "[" + level.String() + "] " + message
+		if len(fields) > 0 {
+			line += " " + strings.Join(fields, " ")
+		}
+
+		l.Print(line)
+	})
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+)
+
+type clientSource struct {
+	client *yagnats.Client
+}
+
+// NewClientCollector instruments client through its publish and callback
+// middleware and reports its statistics when collected.
+func NewClientCollector(client *yagnats.Client, options Options) *Collector {
+	collector := newCollector(&clientSource{client: client}, options)
+
+	client.AddPublishMiddleware(func(next yagnats.PublishFunc) yagnats.PublishFunc {
+		return func(msg *yagnats.Message) error {
+			start := time.Now()
+			err := next(msg)
+			collector.observePublish(msg.Subject, len(msg.Payload), time.Since(start), err)
+			return err
+		}
+	})
+
+	client.AddCallbackMiddleware(func(next yagnats.Callback) yagnats.Callback {
+		return func(msg *yagnats.Message) {
+			collector.observeDelivery(msg.Subject, len(msg.Payload))
+			next(msg)
+		}
+	})
+
+	return collector
+}
+
+func (s *clientSource) snapshot() snapshot {
+	stats := s.client.Statistics()
+	histogram := s.client.RTTHistogram()
+
+	snapshot := snapshot{
+		reconnects: stats.Reconnects,
+		rtt:        histogram.Last,
+		hasRTT:     histogram.Count > 0,
+	}
+
+	for _, sub := range stats.Subscriptions {
+		snapshot.subscriptions = append(snapshot.subscriptions, subscriptionSnapshot{
+			subject: sub.Subject,
+			queue:   sub.Queue,
+			pending: sub.Pending,
+			dropped: sub.Dropped,
+		})
+	}
+
+	return snapshot
+}
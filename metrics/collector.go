@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const DefaultNamespace = "yagnats"
+
+type Options struct {
+	// Namespace prefixes every metric name; defaults to DefaultNamespace.
+	Namespace string
+
+	// SubjectDepth is the number of subject tokens kept in the
+	// subject_prefix label; defaults to 1.
+	SubjectDepth int
+
+	// LatencyBuckets are the publish latency histogram buckets in seconds;
+	// defaults to prometheus.DefBuckets.
+	LatencyBuckets []float64
+}
+
+type Collector struct {
+	source       source
+	subjectDepth int
+
+	messagesIn     *prometheus.CounterVec
+	messagesOut    *prometheus.CounterVec
+	bytesIn        *prometheus.CounterVec
+	bytesOut       *prometheus.CounterVec
+	publishLatency *prometheus.HistogramVec
+
+	reconnects *prometheus.Desc
+	rtt        *prometheus.Desc
+	pending    *prometheus.Desc
+	dropped    *prometheus.Desc
+}
+
+type source interface {
+	snapshot() snapshot
+}
+
+type snapshot struct {
+	reconnects    uint64
+	rtt           time.Duration
+	hasRTT        bool
+	subscriptions []subscriptionSnapshot
+}
+
+type subscriptionSnapshot struct {
+	subject string
+	queue   string
+	pending int64
+	dropped uint64
+}
+
+func newCollector(source source, options Options) *Collector {
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	subjectDepth := options.SubjectDepth
+	if subjectDepth <= 0 {
+		subjectDepth = 1
+	}
+
+	latencyBuckets := options.LatencyBuckets
+	if latencyBuckets == nil {
+		latencyBuckets = prometheus.DefBuckets
+	}
+
+	prefixLabels := []string{"subject_prefix"}
+	subscriptionLabels := []string{"subject", "queue"}
+
+	return &Collector{
+		source:       source,
+		subjectDepth: subjectDepth,
+
+		messagesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_in_total",
+			Help:      "Messages delivered to subscription callbacks.",
+		}, prefixLabels),
+		messagesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_out_total",
+			Help:      "Messages published.",
+		}, prefixLabels),
+		bytesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_in_total",
+			Help:      "Payload bytes delivered to subscription callbacks.",
+		}, prefixLabels),
+		bytesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bytes_out_total",
+			Help:      "Payload bytes published.",
+		}, prefixLabels),
+		publishLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "publish_duration_seconds",
+			Help:      "Time taken to publish a message.",
+			Buckets:   latencyBuckets,
+		}, prefixLabels),
+
+		reconnects: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "reconnects_total"),
+			"Reconnects to the NATS server.",
+			nil, nil,
+		),
+		rtt: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "rtt_seconds"),
+			"Most recent round trip time to the NATS server.",
+			nil, nil,
+		),
+		pending: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "subscription_pending_messages"),
+			"Messages received for a subscription but not yet handled.",
+			subscriptionLabels, nil,
+		),
+		dropped: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "subscription_dropped_messages_total"),
+			"Messages dropped because a subscription was a slow consumer.",
+			subscriptionLabels, nil,
+		),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.messagesIn.Describe(ch)
+	c.messagesOut.Describe(ch)
+	c.bytesIn.Describe(ch)
+	c.bytesOut.Describe(ch)
+	c.publishLatency.Describe(ch)
+
+	ch <- c.reconnects
+	ch <- c.rtt
+	ch <- c.pending
+	ch <- c.dropped
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.messagesIn.Collect(ch)
+	c.messagesOut.Collect(ch)
+	c.bytesIn.Collect(ch)
+	c.bytesOut.Collect(ch)
+	c.publishLatency.Collect(ch)
+
+	snapshot := c.source.snapshot()
+
+	ch <- prometheus.MustNewConstMetric(c.reconnects, prometheus.CounterValue, float64(snapshot.reconnects))
+
+	if snapshot.hasRTT {
+		ch <- prometheus.MustNewConstMetric(c.rtt, prometheus.GaugeValue, snapshot.rtt.Seconds())
+	}
+
+	pending := map[[2]string]int64{}
+	dropped := map[[2]string]uint64{}
+
+	// several subscriptions may share a subject and queue
+	for _, sub := range snapshot.subscriptions {
+		key := [2]string{sub.subject, sub.queue}
+		pending[key] += sub.pending
+		dropped[key] += sub.dropped
+	}
+
+	for key, value := range pending {
+		ch <- prometheus.MustNewConstMetric(c.pending, prometheus.GaugeValue, float64(value), key[0], key[1])
+	}
+
+	for key, value := range dropped {
+		ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(value), key[0], key[1])
+	}
+}
+
+func (c *Collector) observePublish(subject string, size int, elapsed time.Duration, err error) {
+	prefix := c.subjectPrefix(subject)
+
+	c.publishLatency.WithLabelValues(prefix).Observe(elapsed.Seconds())
+
+	if err != nil {
+		return
+	}
+
+	c.observeOut(subject, size)
+}
+
+// observeOut counts a message sent without timing it, for requests whose
+// duration includes waiting for the reply.
+func (c *Collector) observeOut(subject string, size int) {
+	prefix := c.subjectPrefix(subject)
+
+	c.messagesOut.WithLabelValues(prefix).Inc()
+	c.bytesOut.WithLabelValues(prefix).Add(float64(size))
+}
+
+func (c *Collector) observeDelivery(subject string, size int) {
+	prefix := c.subjectPrefix(subject)
+
+	c.messagesIn.WithLabelValues(prefix).Inc()
+	c.bytesIn.WithLabelValues(prefix).Add(float64(size))
+}
+
+func (c *Collector) subjectPrefix(subject string) string {
+	tokens := strings.SplitN(subject, ".", c.subjectDepth+1)
+	if len(tokens) > c.subjectDepth {
+		tokens = tokens[:c.subjectDepth]
+	}
+
+	return strings.Join(tokens, ".")
+}
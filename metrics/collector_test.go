@@ -0,0 +1,392 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+	"github.com/cloudfoundry/yagnats/fakeyagnats"
+	nats "github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorIsAPrometheusCollector(t *testing.T) {
+	var _ prometheus.Collector = NewClientCollector(yagnats.NewClient(), Options{})
+}
+
+func TestConnCollectorCountsTrafficPerSubjectPrefix(t *testing.T) {
+	fake := fakeyagnats.Connect()
+	conn, collector := NewConnCollector(fake, Options{})
+
+	received := 0
+	conn.Subscribe("router.register", func(*nats.Msg) {
+		received++
+	})
+
+	conn.Publish("router.register", []byte("hello"))
+	conn.PublishRequest("router.register", "some.reply", []byte("hi"))
+	conn.Publish("other.subject", []byte("abc"))
+
+	if received != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", received)
+	}
+
+	expected := `
+# HELP yagnats_messages_in_total Messages delivered to subscription callbacks.
+# TYPE yagnats_messages_in_total counter
+yagnats_messages_in_total{subject_prefix="router"} 2
+# HELP yagnats_messages_out_total Messages published.
+# TYPE yagnats_messages_out_total counter
+yagnats_messages_out_total{subject_prefix="other"} 1
+yagnats_messages_out_total{subject_prefix="router"} 2
+# HELP yagnats_bytes_in_total Payload bytes delivered to subscription callbacks.
+# TYPE yagnats_bytes_in_total counter
+yagnats_bytes_in_total{subject_prefix="router"} 7
+# HELP yagnats_bytes_out_total Payload bytes published.
+# TYPE yagnats_bytes_out_total counter
+yagnats_bytes_out_total{subject_prefix="other"} 3
+yagnats_bytes_out_total{subject_prefix="router"} 7
+# HELP yagnats_reconnects_total Reconnects to the NATS server.
+# TYPE yagnats_reconnects_total counter
+yagnats_reconnects_total 0
+`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"yagnats_messages_in_total",
+		"yagnats_messages_out_total",
+		"yagnats_bytes_in_total",
+		"yagnats_bytes_out_total",
+		"yagnats_reconnects_total",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := testutil.CollectAndCount(collector, "yagnats_publish_duration_seconds"); count != 2 {
+		t.Fatalf("expected latency histograms for 2 prefixes, got %d", count)
+	}
+}
+
+func TestConnCollectorDoesNotCountFailedPublishes(t *testing.T) {
+	fake := fakeyagnats.Connect()
+	fake.WhenPublishing("router.register", func(*nats.Msg) error {
+		return errors.New("boom")
+	})
+
+	conn, collector := NewConnCollector(fake, Options{})
+
+	err := conn.Publish("router.register", []byte("hello"))
+	if err == nil {
+		t.Fatal("expected publish to fail")
+	}
+
+	if count := testutil.CollectAndCount(collector, "yagnats_messages_out_total"); count != 0 {
+		t.Fatalf("expected no published messages, got %d", count)
+	}
+
+	if count := testutil.CollectAndCount(collector, "yagnats_publish_duration_seconds"); count != 1 {
+		t.Fatalf("expected failed publish latency to be observed, got %d", count)
+	}
+}
+
+func TestConnCollectorCountsRequests(t *testing.T) {
+	fake := fakeyagnats.Connect()
+	fake.RespondTo("greet", func(*nats.Msg) []byte {
+		return []byte("hello")
+	})
+
+	conn, collector := NewConnCollector(fake, Options{})
+
+	_, err := conn.Request("greet", []byte("hi"), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.RequestWithContext(context.Background(), "greet", []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP yagnats_messages_in_total Messages delivered to subscription callbacks.
+# TYPE yagnats_messages_in_total counter
+yagnats_messages_in_total{subject_prefix="_INBOX"} 2
+# HELP yagnats_messages_out_total Messages published.
+# TYPE yagnats_messages_out_total counter
+yagnats_messages_out_total{subject_prefix="greet"} 2
+`
+
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"yagnats_messages_in_total",
+		"yagnats_messages_out_total",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnCollectorTracksChanSubscriptions(t *testing.T) {
+	fake := fakeyagnats.Connect()
+	conn, collector := NewConnCollector(fake, Options{})
+
+	messages := make(chan *nats.Msg, 1)
+	_, err := conn.ChanSubscribe("router.register", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Publish("router.register", []byte("hello"))
+
+	if msg := <-messages; string(msg.Data) != "hello" {
+		t.Fatalf("unexpected message %q", msg.Data)
+	}
+
+	if count := testutil.CollectAndCount(collector, "yagnats_messages_in_total"); count != 1 {
+		t.Fatalf("expected the delivery to be counted, got %d", count)
+	}
+}
+
+type countingRTTConn struct {
+	*fakeyagnats.FakeNATSConn
+	measured chan bool
+}
+
+func (c *countingRTTConn) RTT() (time.Duration, error) {
+	c.measured <- true
+	return time.Millisecond, nil
+}
+
+func TestConnCollectorCachesRTT(t *testing.T) {
+	fake := &countingRTTConn{FakeNATSConn: fakeyagnats.Connect(), measured: make(chan bool, 10)}
+	_, collector := NewConnCollector(fake, Options{})
+
+	testutil.CollectAndCount(collector)
+
+	select {
+	case <-fake.measured:
+	case <-time.After(time.Second):
+		t.Fatal("expected the rtt to be measured in the background")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for testutil.CollectAndCount(collector, "yagnats_rtt_seconds") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if count := testutil.CollectAndCount(collector, "yagnats_rtt_seconds"); count != 1 {
+		t.Fatalf("expected the cached rtt to be reported, got %d", count)
+	}
+
+	if len(fake.measured) != 0 {
+		t.Fatalf("expected the rtt to be measured once, measured %d more times", len(fake.measured))
+	}
+}
+
+func TestConnectOption(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeNATS(conn)
+		}
+	}()
+
+	option, collector := ConnectOption(Options{})
+
+	conn, err := yagnats.Connect([]string{"nats://" + listener.Addr().String()}, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = conn.Publish("router.register", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP yagnats_messages_out_total Messages published.
+# TYPE yagnats_messages_out_total counter
+yagnats_messages_out_total{subject_prefix="router"} 1
+`
+
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected), "yagnats_messages_out_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each connection gets its own wrapper
+	other, err := yagnats.Connect([]string{"nats://" + listener.Addr().String()}, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	err = conn.Publish("router.register", []byte("again"))
+	if err != nil {
+		t.Fatalf("expected the first connection to be unaffected, got %s", err)
+	}
+}
+
+func TestCollectorSubjectDepth(t *testing.T) {
+	fake := fakeyagnats.Connect()
+	conn, collector := NewConnCollector(fake, Options{Namespace: "test", SubjectDepth: 2})
+
+	conn.Publish("router.register.foo", []byte("a"))
+	conn.Publish("router", []byte("b"))
+
+	expected := `
+# HELP test_messages_out_total Messages published.
+# TYPE test_messages_out_total counter
+test_messages_out_total{subject_prefix="router"} 1
+test_messages_out_total{subject_prefix="router.register"} 1
+`
+
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "test_messages_out_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientCollector(t *testing.T) {
+	client := yagnats.NewClient()
+	client.PendingLimit = 1
+
+	collector := NewClientCollector(client, Options{})
+
+	clientSide, serverSide := net.Pipe()
+	go serveFakeNATS(serverSide)
+
+	err := client.Connect(&yagnats.ConnectionInfo{
+		Addr: "127.0.0.1:4222",
+		Dial: func(network, address string) (net.Conn, error) {
+			return clientSide, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect()
+
+	received := make(chan []byte)
+	block := make(chan bool)
+	defer close(block)
+
+	client.Subscribe("router.register", func(msg *yagnats.Message) {
+		received <- msg.Payload
+		<-block
+	})
+
+	client.Publish("router.register", []byte("hello"))
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	client.Publish("router.register", []byte("dropped"))
+
+	_, err = client.RTT()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP yagnats_messages_in_total Messages delivered to subscription callbacks.
+# TYPE yagnats_messages_in_total counter
+yagnats_messages_in_total{subject_prefix="router"} 1
+# HELP yagnats_messages_out_total Messages published.
+# TYPE yagnats_messages_out_total counter
+yagnats_messages_out_total{subject_prefix="router"} 2
+# HELP yagnats_subscription_pending_messages Messages received for a subscription but not yet handled.
+# TYPE yagnats_subscription_pending_messages gauge
+yagnats_subscription_pending_messages{queue="",subject="router.register"} 1
+# HELP yagnats_subscription_dropped_messages_total Messages dropped because a subscription was a slow consumer.
+# TYPE yagnats_subscription_dropped_messages_total counter
+yagnats_subscription_dropped_messages_total{queue="",subject="router.register"} 1
+`
+
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"yagnats_messages_in_total",
+		"yagnats_messages_out_total",
+		"yagnats_subscription_pending_messages",
+		"yagnats_subscription_dropped_messages_total",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count := testutil.CollectAndCount(collector, "yagnats_rtt_seconds"); count != 1 {
+		t.Fatalf("expected an rtt sample, got %d", count)
+	}
+}
+
+// serveFakeNATS answers just enough of the protocol for a verbose client:
+// +OK for every command, PONG for PING and MSG for subscribed subjects.
+func serveFakeNATS(conn net.Conn) {
+	defer conn.Close()
+
+	io.WriteString(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+
+	reader := bufio.NewReader(conn)
+	sids := map[string]string{}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+
+		case "CONNECT":
+			// only yagnats.Client asks for verbose acknowledgements
+			if strings.Contains(line, `"verbose":true`) {
+				io.WriteString(conn, "+OK\r\n")
+			}
+
+		case "SUB":
+			sids[fields[1]] = fields[len(fields)-1]
+			io.WriteString(conn, "+OK\r\n")
+
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			io.ReadFull(reader, payload)
+
+			io.WriteString(conn, "+OK\r\n")
+
+			if sid, ok := sids[fields[1]]; ok {
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s", fields[1], sid, size, payload)
+			}
+
+		default:
+			io.WriteString(conn, "+OK\r\n")
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+	nats "github.com/nats-io/nats.go"
+)
+
+var ErrRTTNotSupported = errors.New("connection does not measure round trip times")
+
+// rttMaxAge is how old the cached round trip time may be before collecting
+// starts measuring it again in the background.
+const rttMaxAge = 10 * time.Second
+
+// connSource reports on every connection wrapped for one collector.
+type connSource struct {
+	// accessed atomically; kept first for 64-bit alignment
+	reconnects uint64
+
+	collector *Collector
+
+	conns map[*instrumentedConn]struct{}
+	lock  *sync.Mutex
+}
+
+type instrumentedConn struct {
+	yagnats.NATSConn
+
+	source *connSource
+
+	subscriptions map[*nats.Subscription]struct{}
+
+	rtt        time.Duration
+	measuredAt time.Time
+	measuring  bool
+
+	lock *sync.Mutex
+}
+
+type rttMeasurer interface {
+	RTT() (time.Duration, error)
+}
+
+// NewConnCollector wraps conn so that traffic going through the returned
+// NATSConn is reported by the collector.
+func NewConnCollector(conn yagnats.NATSConn, options Options) (yagnats.NATSConn, *Collector) {
+	source := newConnSource(options)
+	return source.wrap(conn), source.collector
+}
+
+// ConnectOption returns a yagnats.Connect option that instruments the
+// connection, and the collector reporting on it. Connections made with the
+// same option are reported together.
+func ConnectOption(options Options) (yagnats.Option, *Collector) {
+	source := newConnSource(options)
+	return yagnats.WithConnWrapper(source.wrap), source.collector
+}
+
+func newConnSource(options Options) *connSource {
+	source := &connSource{
+		conns: map[*instrumentedConn]struct{}{},
+		lock:  &sync.Mutex{},
+	}
+
+	source.collector = newCollector(source, options)
+
+	return source
+}
+
+func (s *connSource) wrap(conn yagnats.NATSConn) yagnats.NATSConn {
+	instrumented := &instrumentedConn{
+		NATSConn: conn,
+		source:   s,
+
+		subscriptions: map[*nats.Subscription]struct{}{},
+		lock:          &sync.Mutex{},
+	}
+
+	s.lock.Lock()
+	s.conns[instrumented] = struct{}{}
+	s.lock.Unlock()
+
+	conn.AddReconnectedCB(func(*nats.Conn) {
+		atomic.AddUint64(&s.reconnects, 1)
+	})
+
+	conn.AddClosedCB(func(*nats.Conn) {
+		s.lock.Lock()
+		delete(s.conns, instrumented)
+		s.lock.Unlock()
+	})
+
+	return instrumented
+}
+
+func (s *connSource) snapshot() snapshot {
+	snapshot := snapshot{
+		reconnects: atomic.LoadUint64(&s.reconnects),
+	}
+
+	s.lock.Lock()
+	conns := make([]*instrumentedConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.lock.Unlock()
+
+	var latest time.Time
+
+	for _, conn := range conns {
+		rtt, measuredAt := conn.cachedRTT()
+		if !measuredAt.IsZero() && measuredAt.After(latest) {
+			snapshot.rtt = rtt
+			snapshot.hasRTT = true
+			latest = measuredAt
+		}
+
+		snapshot.subscriptions = append(snapshot.subscriptions, conn.subscriptionSnapshots()...)
+	}
+
+	return snapshot
+}
+
+func (c *instrumentedConn) Publish(subject string, data []byte) error {
+	start := time.Now()
+	err := c.NATSConn.Publish(subject, data)
+	c.source.collector.observePublish(subject, len(data), time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedConn) PublishRequest(subject, reply string, data []byte) error {
+	start := time.Now()
+	err := c.NATSConn.PublishRequest(subject, reply, data)
+	c.source.collector.observePublish(subject, len(data), time.Since(start), err)
+	return err
+}
+
+func (c *instrumentedConn) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	reply, err := c.NATSConn.Request(subject, data, timeout)
+	c.observeRequest(subject, data, reply, err)
+	return reply, err
+}
+
+func (c *instrumentedConn) RequestWithContext(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	reply, err := c.NATSConn.RequestWithContext(ctx, subject, data)
+	c.observeRequest(subject, data, reply, err)
+	return reply, err
+}
+
+func (c *instrumentedConn) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	sub, err := c.NATSConn.Subscribe(subject, c.instrumentHandler(handler))
+	if err != nil {
+		return nil, err
+	}
+
+	c.track(sub)
+
+	return sub, nil
+}
+
+func (c *instrumentedConn) QueueSubscribe(subject, queue string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	sub, err := c.NATSConn.QueueSubscribe(subject, queue, c.instrumentHandler(handler))
+	if err != nil {
+		return nil, err
+	}
+
+	c.track(sub)
+
+	return sub, nil
+}
+
+// ChanSubscribe counts messages on their way into ch, so a full channel
+// holds up the subscription's handler rather than dropping the message.
+func (c *instrumentedConn) ChanSubscribe(subject string, ch chan *nats.Msg) (*nats.Subscription, error) {
+	return c.Subscribe(subject, func(msg *nats.Msg) {
+		ch <- msg
+	})
+}
+
+// SubscribeSync subscriptions are tracked, but the messages taken from them
+// with NextMsg are not counted.
+func (c *instrumentedConn) SubscribeSync(subject string) (*nats.Subscription, error) {
+	sub, err := c.NATSConn.SubscribeSync(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	c.track(sub)
+
+	return sub, nil
+}
+
+func (c *instrumentedConn) Unsubscribe(sub *nats.Subscription) error {
+	c.lock.Lock()
+	delete(c.subscriptions, sub)
+	c.lock.Unlock()
+
+	return c.NATSConn.Unsubscribe(sub)
+}
+
+// RTT measures the round trip time and caches it for the collector.
+func (c *instrumentedConn) RTT() (time.Duration, error) {
+	measurer, ok := c.NATSConn.(rttMeasurer)
+	if !ok {
+		return 0, ErrRTTNotSupported
+	}
+
+	rtt, err := measurer.RTT()
+	if err != nil {
+		return 0, err
+	}
+
+	c.lock.Lock()
+	c.rtt = rtt
+	c.measuredAt = time.Now()
+	c.lock.Unlock()
+
+	return rtt, nil
+}
+
+// cachedRTT returns the last measured round trip time without waiting on
+// the server, and measures it again in the background once it is stale.
+func (c *instrumentedConn) cachedRTT() (time.Duration, time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, measurable := c.NATSConn.(rttMeasurer)
+
+	if measurable && !c.measuring && time.Since(c.measuredAt) > rttMaxAge {
+		c.measuring = true
+
+		go func() {
+			c.RTT()
+
+			c.lock.Lock()
+			c.measuring = false
+			c.lock.Unlock()
+		}()
+	}
+
+	return c.rtt, c.measuredAt
+}
+
+func (c *instrumentedConn) observeRequest(subject string, data []byte, reply *nats.Msg, err error) {
+	// a request that timed out was still sent
+	if err == nil || err == nats.ErrTimeout || err == context.DeadlineExceeded {
+		c.source.collector.observeOut(subject, len(data))
+	}
+
+	if reply != nil {
+		c.source.collector.observeDelivery(reply.Subject, len(reply.Data))
+	}
+}
+
+func (c *instrumentedConn) instrumentHandler(handler nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		c.source.collector.observeDelivery(msg.Subject, len(msg.Data))
+		handler(msg)
+	}
+}
+
+func (c *instrumentedConn) track(sub *nats.Subscription) {
+	c.lock.Lock()
+	c.subscriptions[sub] = struct{}{}
+	c.lock.Unlock()
+}
+
+func (c *instrumentedConn) subscriptionSnapshots() []subscriptionSnapshot {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	snapshots := []subscriptionSnapshot{}
+
+	for sub := range c.subscriptions {
+		// subscriptions not backed by a live connection report errors here
+		pending, _, err := sub.Pending()
+		if err != nil {
+			continue
+		}
+
+		dropped, err := sub.Dropped()
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, subscriptionSnapshot{
+			subject: sub.Subject,
+			queue:   sub.Queue,
+			pending: int64(pending),
+			dropped: uint64(dropped),
+		})
+	}
+
+	return snapshots
+}
@@ -0,0 +1,47 @@
+package yagnats
+
+type PublishFunc func(*Message) error
+
+type PublishMiddleware func(PublishFunc) PublishFunc
+
+type CallbackMiddleware func(Callback) Callback
+
+func (c *Client) AddPublishMiddleware(middleware PublishMiddleware) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.publishMiddleware = append(c.publishMiddleware, middleware)
+}
+
+func (c *Client) AddCallbackMiddleware(middleware CallbackMiddleware) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.callbackMiddleware = append(c.callbackMiddleware, middleware)
+}
+
+// middlewares wrap in registration order, so the first one added sees the
+// message first
+func (c *Client) wrapPublish(publish PublishFunc) PublishFunc {
+	c.lock.Lock()
+	middleware := c.publishMiddleware
+	c.lock.Unlock()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		publish = middleware[i](publish)
+	}
+
+	return publish
+}
+
+func (c *Client) wrapCallback(callback Callback) Callback {
+	c.lock.Lock()
+	middleware := c.callbackMiddleware
+	c.lock.Unlock()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		callback = middleware[i](callback)
+	}
+
+	return callback
+}
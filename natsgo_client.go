@@ -0,0 +1,270 @@
+package yagnats
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+var ErrNotSupportedByNATSGo = errors.New("not supported by the nats.go backend")
+var ErrUnsupportedProvider = errors.New("nats.go backend only supports ConnectionInfo, ConnectionCluster and ChaosConnectionProvider")
+var ErrMixedTLSInfo = errors.New("nats.go backend needs the same TLSInfo on every cluster member")
+
+var errMissingAddress = errors.New("missing address")
+
+// NewClientWithNATSGo returns a NATSClient implemented on top of nats.go
+// instead of this package's own protocol implementation.
+//
+// Connect accepts ConnectionInfo, ConnectionCluster and
+// ChaosConnectionProvider providers. Other providers hand out connections
+// that have already spoken the NATS protocol, which nats.go cannot take
+// over, so they fail with ErrUnsupportedProvider. Cluster members are tried
+// in order and the client reconnects forever, as Client does.
+// BeforeConnectCallback runs before every dial. Unix sockets and
+// HandshakeFirst are not supported, and nats.go has a single TLS
+// configuration per connection, so every member needs an equal TLSInfo.
+// RotationCheckInterval is honored by forcing a reconnect. Connecting again
+// closes the previous connection.
+//
+// Unlike Client, which blocks publishes and subscribes until it has
+// connected, the returned client fails them with ErrNotConnected before
+// Connect has succeeded.
+func NewClientWithNATSGo() NATSClient {
+	return &natsGoClient{
+		connClient: &connClient{
+			subscriptions: map[int64]*nats.Subscription{},
+			lock:          &sync.Mutex{},
+		},
+	}
+}
+
+type natsGoClient struct {
+	*connClient
+
+	beforeConnectCallback func()
+}
+
+func (c *natsGoClient) Connect(cp ConnectionProvider) error {
+	members, err := connectionInfos(cp)
+	if err != nil {
+		return err
+	}
+
+	opts := DefaultOptions()
+	opts.NoRandomize = true
+
+	dialer := &memberDialer{
+		dials:         map[string]func(network, address string) (net.Conn, error){},
+		beforeConnect: c.beforeConnect,
+		lock:          &sync.Mutex{},
+	}
+
+	tlsInfo := members[0].TLSInfo
+
+	servers := make([]string, 0, len(members))
+	for _, member := range members {
+		if !member.TLSInfo.equal(tlsInfo) {
+			return ErrMixedTLSInfo
+		}
+
+		server, err := member.natsURL()
+		if err != nil {
+			return err
+		}
+
+		servers = append(servers, server.String())
+
+		dial := member.dialer()
+		if isWebSocketURL(member.Addr) && server.Port() == "" {
+			// nats.go dials the bare host; dial the default port as Client does
+			address := net.JoinHostPort(server.Hostname(), webSocketPort(server.Scheme))
+			memberDial := dial
+
+			dial = func(network, _ string) (net.Conn, error) {
+				return memberDial(network, address)
+			}
+		}
+
+		dialer.dials[server.Host] = dial
+	}
+
+	var reloader *certReloader
+
+	if tlsInfo != nil {
+		opts.Secure = true
+
+		opts.TLSConfig, reloader, err = tlsInfo.config()
+		if err != nil {
+			return err
+		}
+
+		if reloader != nil && tlsInfo.CAFile != "" {
+			// nats.go clones the config per connect, so reread the CA there
+			opts.RootCAsCB = reloader.rootCAs
+		}
+	}
+
+	opts.CustomDialer = dialer
+
+	conn, err := ConnectWithOptions(servers, opts)
+	switch {
+	case err == nats.ErrNoServers && dialer.lastError() != nil:
+		// report why the servers could not be reached, as Client does
+		return dialer.lastError()
+
+	case err == nats.ErrSecureConnWanted:
+		return ErrSecureConnWanted
+
+	case err == nats.ErrSecureConnRequired:
+		return ErrSecureConnRequired
+
+	case err != nil:
+		return err
+	}
+
+	if reloader != nil && tlsInfo.RotationCheckInterval > 0 {
+		go reconnectOnRotation(conn.(*apceraNATSWrapper).Conn, reloader, tlsInfo.RotationCheckInterval)
+	}
+
+	c.lock.Lock()
+	previous := c.conn
+	c.conn = conn
+	c.lock.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+
+	return nil
+}
+
+func (c *natsGoClient) BeforeConnectCallback(callback func()) {
+	c.lock.Lock()
+	c.beforeConnectCallback = callback
+	c.lock.Unlock()
+}
+
+func (c *natsGoClient) beforeConnect() {
+	c.lock.Lock()
+	callback := c.beforeConnectCallback
+	c.lock.Unlock()
+
+	if callback != nil {
+		callback()
+	}
+}
+
+// reconnectOnRotation forces conn to reconnect once the files change, so
+// that the TLS handshake picks up the new credentials.
+func reconnectOnRotation(conn *nats.Conn, reloader *certReloader, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if conn.IsClosed() {
+			return
+		}
+
+		changed, err := reloader.reload()
+		if err != nil || !changed {
+			continue
+		}
+
+		conn.ForceReconnect()
+	}
+}
+
+func connectionInfos(cp ConnectionProvider) ([]*ConnectionInfo, error) {
+	switch provider := cp.(type) {
+	case *ConnectionInfo:
+		return []*ConnectionInfo{provider}, nil
+
+	case *ConnectionCluster:
+		members := []*ConnectionInfo{}
+		for _, member := range provider.Members {
+			infos, err := connectionInfos(member)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, infos...)
+		}
+		return members, nil
+
+	case *ChaosConnectionProvider:
+		return provider.connectionInfos()
+
+	default:
+		return nil, ErrUnsupportedProvider
+	}
+}
+
+func (c *ConnectionInfo) natsURL() (*url.URL, error) {
+	if c.Network == "unix" || (c.TLSInfo != nil && c.TLSInfo.HandshakeFirst) {
+		return nil, ErrNotSupportedByNATSGo
+	}
+
+	if c.Addr == "" {
+		// what dialing an empty address fails with in Client
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errMissingAddress}
+	}
+
+	server := &url.URL{Scheme: "nats", Host: c.Addr}
+
+	if isWebSocketURL(c.Addr) {
+		var err error
+		server, err = url.Parse(c.Addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Username != "" {
+		server.User = url.UserPassword(c.Username, c.Password)
+	}
+
+	return server, nil
+}
+
+func webSocketPort(scheme string) string {
+	if scheme == "wss" {
+		return "443"
+	}
+
+	return "80"
+}
+
+// memberDialer dials each cluster member the way its ConnectionInfo would.
+type memberDialer struct {
+	dials         map[string]func(network, address string) (net.Conn, error)
+	beforeConnect func()
+
+	lastErr error
+	lock    *sync.Mutex
+}
+
+func (d *memberDialer) Dial(network, address string) (net.Conn, error) {
+	d.beforeConnect()
+
+	dial, ok := d.dials[address]
+	if !ok {
+		dial = (&ConnectionInfo{}).dialer()
+	}
+
+	conn, err := dial(network, address)
+
+	d.lock.Lock()
+	d.lastErr = err
+	d.lock.Unlock()
+
+	return conn, err
+}
+
+func (d *memberDialer) lastError() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.lastErr
+}
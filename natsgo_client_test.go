@@ -0,0 +1,74 @@
+package yagnats
+
+import (
+	"github.com/nats-io/nats-server/v2/server"
+	. "gopkg.in/check.v1"
+)
+
+// NATSGoSuite covers what only the client from NewClientWithNATSGo does;
+// YSuite runs the behaviour it shares with Client.
+type NATSGoSuite struct {
+	NatsServer *server.Server
+}
+
+var _ = Suite(&NATSGoSuite{})
+
+func (s *NATSGoSuite) SetUpSuite(c *C) {
+	s.NatsServer = startNats(4576)
+	waitUntilNatsUp(4576)
+}
+
+func (s *NATSGoSuite) TearDownSuite(c *C) {
+	stopNats(s.NatsServer)
+}
+
+func (s *NATSGoSuite) TestConnectRejectsOtherProviders(c *C) {
+	client := NewClientWithNATSGo()
+
+	err := client.Connect(&FakeConnectionProvider{ReadBuffer: "+OK\r\n"})
+	c.Assert(err, Equals, ErrUnsupportedProvider)
+}
+
+func (s *NATSGoSuite) TestConnectThroughChaosProvider(c *C) {
+	chaos := NewChaosConnectionProvider(&ConnectionInfo{
+		Addr:     "127.0.0.1:4576",
+		Username: "nats",
+		Password: "nats",
+	}, 1)
+	chaos.DialFailureRate = 1
+
+	client := NewClientWithNATSGo()
+
+	err := client.Connect(chaos)
+	c.Assert(err, Equals, ErrInjectedDialFailure)
+
+	chaos.DialFailureRate = 0
+
+	err = client.Connect(chaos)
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	c.Assert(client.Ping(), Equals, true)
+}
+
+func (s *NATSGoSuite) TestConnectAgainClosesThePreviousConnection(c *C) {
+	client := NewClientWithNATSGo()
+
+	info := &ConnectionInfo{
+		Addr:     "127.0.0.1:4576",
+		Username: "nats",
+		Password: "nats",
+	}
+
+	err := client.Connect(info)
+	c.Assert(err, IsNil)
+
+	previous := client.(*natsGoClient).connection().(*apceraNATSWrapper)
+
+	err = client.Connect(info)
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	c.Assert(previous.IsClosed(), Equals, true)
+	c.Assert(client.Ping(), Equals, true)
+}
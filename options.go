@@ -0,0 +1,166 @@
+package yagnats
+
+import (
+	"crypto/tls"
+	"time"
+
+	nats "github.com/nats-io/nats.go"
+)
+
+// Option configures the connection made by Connect.
+type Option func(*connectOptions) error
+
+type connectOptions struct {
+	nats     nats.Options
+	logger   Logger
+	wrappers []func(NATSConn) NATSConn
+}
+
+// Connect connects to the first reachable server in urls. Options are
+// applied on top of DefaultOptions.
+func Connect(urls []string, options ...Option) (NATSConn, error) {
+	opts := &connectOptions{nats: DefaultOptions()}
+
+	for _, option := range options {
+		err := option(opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.logger != nil {
+		logConnectionEvents(&opts.nats, opts.logger)
+	}
+
+	conn, err := ConnectWithOptions(urls, opts.nats)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, wrap := range opts.wrappers {
+		conn = wrap(conn)
+	}
+
+	return conn, nil
+}
+
+// WithTLSFiles connects over TLS using PEM files. The files are reread
+// whenever they change, so reconnects pick up rotated credentials. certFile
+// and keyFile may be empty when no client certificate is needed, and caFile
+// when the system roots should be used.
+func WithTLSFiles(certFile, keyFile, caFile string) Option {
+	return func(opts *connectOptions) error {
+		config := &tls.Config{}
+
+		if certFile != "" || caFile != "" {
+			reloader := newCertReloader(certFile, keyFile, caFile)
+
+			var err error
+
+			config, err = reloader.tlsConfig(nil)
+			if err != nil {
+				return err
+			}
+
+			if caFile != "" {
+				opts.nats.RootCAsCB = reloader.rootCAs
+			}
+		}
+
+		opts.nats.Secure = true
+		opts.nats.TLSConfig = config
+		return nil
+	}
+}
+
+// WithUserInfo authenticates with a username and password.
+func WithUserInfo(user, password string) Option {
+	return func(opts *connectOptions) error {
+		opts.nats.User = user
+		opts.nats.Password = password
+		return nil
+	}
+}
+
+// WithCredentialsFile authenticates with a NATS .creds file holding a user
+// JWT and nkey seed.
+func WithCredentialsFile(path string) Option {
+	return func(opts *connectOptions) error {
+		return nats.UserCredentials(path)(&opts.nats)
+	}
+}
+
+// WithName sets the connection name shown in the server's monitoring.
+func WithName(name string) Option {
+	return func(opts *connectOptions) error {
+		opts.nats.Name = name
+		return nil
+	}
+}
+
+// WithPingInterval sets how often the server is pinged to detect a dead
+// connection.
+func WithPingInterval(interval time.Duration) Option {
+	return func(opts *connectOptions) error {
+		opts.nats.PingInterval = interval
+		return nil
+	}
+}
+
+// WithReconnectBufSize sets how many bytes of publishes are buffered while
+// reconnecting. A negative size disables buffering.
+func WithReconnectBufSize(size int) Option {
+	return func(opts *connectOptions) error {
+		opts.nats.ReconnectBufSize = size
+		return nil
+	}
+}
+
+// WithLogger logs disconnects, reconnects, lame duck mode and async errors.
+func WithLogger(logger Logger) Option {
+	return func(opts *connectOptions) error {
+		opts.logger = logger
+		return nil
+	}
+}
+
+// WithConnWrapper wraps the connected NATSConn, for instance to instrument
+// it. Wrappers are applied in order, so the last one is outermost.
+func WithConnWrapper(wrap func(NATSConn) NATSConn) Option {
+	return func(opts *connectOptions) error {
+		opts.wrappers = append(opts.wrappers, wrap)
+		return nil
+	}
+}
+
+func logConnectionEvents(opts *nats.Options, logger Logger) {
+	opts.DisconnectedErrCB = func(conn *nats.Conn, err error) {
+		if err == nil {
+			logger.Warn("nats.connection.disconnected")
+			return
+		}
+
+		logger.Warnd(map[string]interface{}{"error": err.Error()}, "nats.connection.disconnected")
+	}
+
+	opts.ReconnectedCB = func(conn *nats.Conn) {
+		logger.Infod(map[string]interface{}{"url": conn.ConnectedUrlRedacted()}, "nats.connection.reconnected")
+	}
+
+	opts.ClosedCB = func(conn *nats.Conn) {
+		logger.Info("nats.connection.closed")
+	}
+
+	opts.LameDuckModeHandler = func(conn *nats.Conn) {
+		logger.Warn("nats.connection.lame-duck")
+	}
+
+	opts.AsyncErrorCB = func(conn *nats.Conn, sub *nats.Subscription, err error) {
+		data := map[string]interface{}{"error": err.Error()}
+		if sub != nil {
+			data["subject"] = sub.Subject
+		}
+
+		logger.Errord(data, "nats.connection.async-error")
+	}
+}
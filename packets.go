@@ -5,6 +5,17 @@ import (
 	"fmt"
 )
 
+type ServerInfo struct {
+	ServerID     string `json:"server_id"`
+	Version      string `json:"version"`
+	MaxPayload   int64  `json:"max_payload"`
+	Headers      bool   `json:"headers"`
+	AuthRequired bool   `json:"auth_required"`
+	TLSRequired  bool   `json:"tls_required"`
+	TLSAvailable bool   `json:"tls_available"`
+	LameDuckMode bool   `json:"ldm"`
+}
+
 type Packet interface {
 	Encode() []byte
 }
@@ -29,9 +40,16 @@ func (p *InfoPacket) Encode() []byte {
 	return []byte(fmt.Sprintf("INFO %s\r\n", p.Payload))
 }
 
+func (p *InfoPacket) ServerInfo() (ServerInfo, error) {
+	info := ServerInfo{}
+	err := json.Unmarshal([]byte(p.Payload), &info)
+	return info, err
+}
+
 type ConnectPacket struct {
-	User string
-	Pass string
+	User    string
+	Pass    string
+	Headers bool
 }
 
 type connectionPayload struct {
@@ -39,6 +57,8 @@ type connectionPayload struct {
 	Pass     string `json:"pass"`
 	Verbose  bool   `json:"verbose"`
 	Pedantic bool   `json:"pedantic"`
+	Headers  bool   `json:"headers,omitempty"`
+	Protocol int    `json:"protocol"`
 }
 
 func (p *ConnectPacket) Encode() []byte {
@@ -47,6 +67,11 @@ func (p *ConnectPacket) Encode() []byte {
 		Pedantic: true,
 		User:     p.User,
 		Pass:     p.Pass,
+		Headers:  p.Headers,
+
+		// protocol 1 asks the server for asynchronous INFO updates, such as
+		// lame duck mode announcements
+		Protocol: 1,
 	}
 
 	json, err := json.Marshal(payload)
@@ -96,10 +121,15 @@ func (p *UnsubPacket) Encode() []byte {
 type PubPacket struct {
 	Subject string
 	ReplyTo string
+	Header  Header
 	Payload []byte
 }
 
 func (p *PubPacket) Encode() []byte {
+	if len(p.Header) > 0 {
+		return encodeWithHeader("HPUB", p.Subject, "", p.ReplyTo, p.Header, p.Payload)
+	}
+
 	if p.ReplyTo != "" {
 		return []byte(
 			fmt.Sprintf(
@@ -121,10 +151,15 @@ type MsgPacket struct {
 	Subject string
 	SubID   int64
 	ReplyTo string
+	Header  Header
 	Payload []byte
 }
 
 func (p *MsgPacket) Encode() []byte {
+	if len(p.Header) > 0 {
+		return encodeWithHeader("HMSG", p.Subject, fmt.Sprintf(" %d", p.SubID), p.ReplyTo, p.Header, p.Payload)
+	}
+
 	if p.ReplyTo != "" {
 		return []byte(
 			fmt.Sprintf(
@@ -141,3 +176,18 @@ func (p *MsgPacket) Encode() []byte {
 		)
 	}
 }
+
+func encodeWithHeader(op, subject, sid, reply string, header Header, payload []byte) []byte {
+	encodedHeader := header.encode()
+
+	if reply != "" {
+		reply = " " + reply
+	}
+
+	return []byte(
+		fmt.Sprintf(
+			"%s %s%s%s %d %d\r\n%s%s\r\n",
+			op, subject, sid, reply, len(encodedHeader), len(encodedHeader)+len(payload), encodedHeader, payload,
+		),
+	)
+}
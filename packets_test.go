@@ -38,6 +38,7 @@ func (s *YSuite) TestConnectEncode(c *C) {
 	c.Check(parsed.Pedantic, Equals, true)
 	c.Check(parsed.User, Equals, "foo")
 	c.Check(parsed.Pass, Equals, "bar")
+	c.Check(parsed.Protocol, Equals, 1)
 }
 
 func (s *YSuite) TestOKEncode(c *C) {
@@ -84,3 +85,25 @@ func (s *YSuite) TestMsgEncodeWithReplyTo(c *C) {
 	packet := &MsgPacket{Subject: "some.subject", SubID: 42, ReplyTo: "some.reply", Payload: []byte("sup?")}
 	c.Assert(string(packet.Encode()), Equals, "MSG some.subject 42 some.reply 4\r\nsup?\r\n")
 }
+
+func (s *YSuite) TestPubEncodeWithHeader(c *C) {
+	packet := &PubPacket{
+		Subject: "some.subject",
+		ReplyTo: "some.reply",
+		Header:  Header{"a": {"1"}},
+		Payload: []byte("hi"),
+	}
+
+	c.Assert(string(packet.Encode()), Equals, "HPUB some.subject some.reply 18 20\r\nNATS/1.0\r\na: 1\r\n\r\nhi\r\n")
+}
+
+func (s *YSuite) TestMsgEncodeWithHeader(c *C) {
+	packet := &MsgPacket{
+		Subject: "some.subject",
+		SubID:   42,
+		Header:  Header{"a": {"1"}},
+		Payload: []byte("hi"),
+	}
+
+	c.Assert(string(packet.Encode()), Equals, "HMSG some.subject 42 18 20\r\nNATS/1.0\r\na: 1\r\n\r\nhi\r\n")
+}
@@ -46,7 +46,7 @@ var PARSERS = map[string]Parser{
 	// INFO (payload)\r\n
 	"INFO": func(io *bufio.Reader) (Packet, error) {
 		bytes, _ := io.ReadBytes('\n')
-		re := regexp.MustCompile(`\s*([^\s]+)\s*\r\n`)
+		re := regexp.MustCompile(`^\s*(\S.*?)\s*\r\n`)
 
 		match := re.FindSubmatchIndex(bytes)
 
@@ -84,6 +84,45 @@ var PARSERS = map[string]Parser{
 			Payload: payload,
 		}, nil
 	},
+
+	// HMSG (subject) (subscriber-id) (reply)? (header-length) (total-length)\r\n(byte * total-length)\r\n
+	"HMSG": func(io *bufio.Reader) (Packet, error) {
+		bytes, _ := io.ReadBytes('\n')
+		re := regexp.MustCompile(`\s*([^\s]+)\s+(\d+)\s+(([^\s]+)\s+)?(\d+)\s+(\d+)\s*\r\n`)
+		matches := re.FindStringSubmatch(string(bytes))
+
+		if matches == nil {
+			return nil, errors.New("Malformed HMSG message")
+		}
+
+		subID, _ := strconv.ParseInt(matches[2], 10, 64)
+		headerLen, _ := strconv.Atoi(matches[5])
+		totalLen, _ := strconv.Atoi(matches[6])
+
+		if headerLen > totalLen {
+			return nil, errors.New("Malformed HMSG message")
+		}
+
+		data, err := readNBytes(totalLen, io)
+		if err != nil {
+			return nil, err
+		}
+
+		io.ReadBytes('\n')
+
+		header, err := parseHeader(data[:headerLen])
+		if err != nil {
+			return nil, err
+		}
+
+		return &MsgPacket{
+			Subject: matches[1],
+			SubID:   subID,
+			ReplyTo: matches[4],
+			Header:  header,
+			Payload: data[headerLen:],
+		}, nil
+	},
 }
 
 func Parse(io *bufio.Reader) (val Packet, err error) {
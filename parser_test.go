@@ -98,3 +98,28 @@ func (s *YSuite) TestParseMultiMsg(c *C) {
 	c.Assert(parse2, Not(Equals), nil)
 	c.Assert(string(parse2.Encode()), Equals, "MSG some.other.subject 43 6\r\nsup 2?\r\n")
 }
+
+func (s *YSuite) TestParseInfoWithSpaces(c *C) {
+	packet, err := Parse(bufio.NewReader(bytes.NewBuffer([]byte("INFO {\"server_id\": \"abc\", \"headers\": true} \r\n"))))
+
+	c.Assert(err, Equals, nil)
+
+	info, err := packet.(*InfoPacket).ServerInfo()
+	c.Assert(err, Equals, nil)
+	c.Assert(info.ServerID, Equals, "abc")
+	c.Assert(info.Headers, Equals, true)
+}
+
+func (s *YSuite) TestParseHMsg(c *C) {
+	packet, err := Parse(bufio.NewReader(bytes.NewBuffer([]byte("HMSG some.subject 42 some.reply 30 32\r\nNATS/1.0\r\na: 1\r\na: 2\r\nb: 3\r\n\r\nhi\r\n"))))
+
+	c.Assert(err, Equals, nil)
+
+	msg := packet.(*MsgPacket)
+	c.Assert(msg.Subject, Equals, "some.subject")
+	c.Assert(msg.SubID, Equals, int64(42))
+	c.Assert(msg.ReplyTo, Equals, "some.reply")
+	c.Assert(msg.Header["a"], DeepEquals, []string{"1", "2"})
+	c.Assert(msg.Header.Get("b"), Equals, "3")
+	c.Assert(string(msg.Payload), Equals, "hi")
+}
@@ -0,0 +1,185 @@
+package yagnats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// ProxyDialer returns a dial function for ConnectionInfo.Dial that tunnels
+// through the proxy at proxyURL. http:// and https:// proxies are sent a
+// CONNECT request; socks5:// and socks5h:// proxies speak SOCKS5. Credentials
+// are taken from the URL's user info. forward, when set, opens the
+// connection to the proxy itself.
+func ProxyDialer(proxyURL *url.URL, forward func(network, address string) (net.Conn, error)) (func(network, address string) (net.Conn, error), error) {
+	if forward == nil {
+		forward = (&net.Dialer{Timeout: DefaultDialTimeout}).Dial
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https":
+		return httpConnectDialer(proxyURL, forward), nil
+
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, dialFunc(forward))
+		if err != nil {
+			return nil, err
+		}
+
+		return dialer.Dial, nil
+	}
+
+	return nil, errors.New("unsupported proxy scheme: " + proxyURL.Scheme)
+}
+
+// ProxyDialerFromEnvironment configures a proxy from NATS_PROXY, falling back
+// to ALL_PROXY, and skips it for addresses matched by NO_PROXY and for
+// loopback addresses. The lower case variants are honoured too. Without a
+// proxy it dials directly.
+func ProxyDialerFromEnvironment(forward func(network, address string) (net.Conn, error)) (func(network, address string) (net.Conn, error), error) {
+	if forward == nil {
+		forward = (&net.Dialer{Timeout: DefaultDialTimeout}).Dial
+	}
+
+	proxyEnv := getEnvAny("NATS_PROXY", "nats_proxy", "ALL_PROXY", "all_proxy")
+	if proxyEnv == "" {
+		return forward, nil
+	}
+
+	proxyURL, err := url.Parse(proxyEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	proxied, err := ProxyDialer(proxyURL, forward)
+	if err != nil {
+		return nil, err
+	}
+
+	// httpproxy implements the NO_PROXY matching rules, including CIDRs
+	// and domain suffixes
+	proxyFor := (&httpproxy.Config{
+		HTTPSProxy: proxyEnv,
+		NoProxy:    getEnvAny("NO_PROXY", "no_proxy"),
+	}).ProxyFunc()
+
+	return func(network, address string) (net.Conn, error) {
+		via, err := proxyFor(&url.URL{Scheme: "https", Host: address})
+		if err != nil {
+			return nil, err
+		}
+
+		if via == nil {
+			return forward(network, address)
+		}
+
+		return proxied(network, address)
+	}, nil
+}
+
+func httpConnectDialer(proxyURL *url.URL, forward func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	return func(network, address string) (net.Conn, error) {
+		proxyAddr := proxyURL.Host
+		if proxyURL.Port() == "" {
+			port := "80"
+			if proxyURL.Scheme == "https" {
+				port = "443"
+			}
+
+			proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+		}
+
+		conn, err := forward("tcp", proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		if proxyURL.Scheme == "https" {
+			conn = tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		}
+
+		// a stalled proxy must not hang the dial; the deadline is cleared
+		// once the tunnel is up
+		conn.SetDeadline(time.Now().Add(setupTimeout))
+
+		request := &http.Request{
+			Method: "CONNECT",
+			URL:    &url.URL{Opaque: address},
+			Host:   address,
+			Header: http.Header{},
+		}
+
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+			request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+		}
+
+		err = request.Write(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		reader := bufio.NewReader(conn)
+
+		response, err := http.ReadResponse(reader, request)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			conn.Close()
+			return nil, fmt.Errorf("proxy refused CONNECT to %s: %s", address, response.Status)
+		}
+
+		err = conn.SetDeadline(time.Time{})
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		// the server's INFO may have arrived along with the proxy's response
+		if reader.Buffered() > 0 {
+			return &bufferedConn{Conn: conn, reader: reader}, nil
+		}
+
+		return conn, nil
+	}
+}
+
+type dialFunc func(network, address string) (net.Conn, error)
+
+func (f dialFunc) Dial(network, address string) (net.Conn, error) {
+	return f(network, address)
+}
+
+func getEnvAny(names ...string) string {
+	for _, name := range names {
+		value := os.Getenv(name)
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,322 @@
+package yagnats
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *YSuite) TestClientThroughHTTPConnectProxy(c *C) {
+	proxyAddr, connections := startHTTPConnectProxy(c, "Basic dXNlcjpzZWNyZXQ=")
+
+	dial, err := ProxyDialer(&url.URL{Scheme: "http", Host: proxyAddr, User: url.UserPassword("user", "secret")}, nil)
+	c.Assert(err, IsNil)
+
+	client := s.newClient()
+	defer client.Disconnect()
+
+	err = client.Connect(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+		Dial:     dial,
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(client.Ping(), Equals, true)
+	c.Assert(atomic.LoadInt32(connections), Equals, int32(1))
+}
+
+func (s *YSuite) TestClientThroughHTTPConnectProxyWithWrongCredentials(c *C) {
+	proxyAddr, _ := startHTTPConnectProxy(c, "Basic dXNlcjpzZWNyZXQ=")
+
+	dial, err := ProxyDialer(&url.URL{Scheme: "http", Host: proxyAddr, User: url.UserPassword("user", "wrong")}, nil)
+	c.Assert(err, IsNil)
+
+	client := s.newClient()
+
+	err = client.Connect(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+		Dial:     dial,
+	})
+	c.Assert(err, ErrorMatches, ".*407 Proxy Authentication Required")
+}
+
+func (s *YSuite) TestHTTPConnectProxyDialTimesOutOnStalledProxy(c *C) {
+	clientSide, serverSide := net.Pipe()
+	defer serverSide.Close()
+
+	// the proxy reads the CONNECT request and never answers
+	go io.Copy(io.Discard, serverSide)
+
+	dial, err := ProxyDialer(&url.URL{Scheme: "http", Host: "proxy:3128"}, func(network, address string) (net.Conn, error) {
+		return clientSide, nil
+	})
+	c.Assert(err, IsNil)
+
+	_, err = dial("tcp", "127.0.0.1:4223")
+	c.Assert(err, NotNil)
+
+	netErr, ok := err.(net.Error)
+	c.Assert(ok, Equals, true)
+	c.Assert(netErr.Timeout(), Equals, true)
+}
+
+func (s *YSuite) TestClientThroughSOCKS5Proxy(c *C) {
+	proxyAddr, connections := startSOCKS5Proxy(c, "user", "secret")
+
+	dial, err := ProxyDialer(&url.URL{Scheme: "socks5", Host: proxyAddr, User: url.UserPassword("user", "secret")}, nil)
+	c.Assert(err, IsNil)
+
+	client := s.newClient()
+	defer client.Disconnect()
+
+	err = client.Connect(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+		Dial:     dial,
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(client.Ping(), Equals, true)
+	c.Assert(atomic.LoadInt32(connections), Equals, int32(1))
+}
+
+func (s *YSuite) TestClientThroughSOCKS5ProxyWithWrongCredentials(c *C) {
+	proxyAddr, _ := startSOCKS5Proxy(c, "user", "secret")
+
+	dial, err := ProxyDialer(&url.URL{Scheme: "socks5", Host: proxyAddr, User: url.UserPassword("user", "wrong")}, nil)
+	c.Assert(err, IsNil)
+
+	client := s.newClient()
+
+	err = client.Connect(&ConnectionInfo{
+		Addr:     "127.0.0.1:4223",
+		Username: "nats",
+		Password: "nats",
+		Dial:     dial,
+	})
+	c.Assert(err, NotNil)
+}
+
+func (s *YSuite) TestProxyDialerUnsupportedScheme(c *C) {
+	_, err := ProxyDialer(&url.URL{Scheme: "ftp", Host: "127.0.0.1:21"}, nil)
+	c.Assert(err, ErrorMatches, "unsupported proxy scheme: ftp")
+}
+
+func (s *YSuite) TestProxyDialerFromEnvironment(c *C) {
+	proxyAddr, requests := startSOCKS5Proxy(c, "", "")
+
+	os.Setenv("NATS_PROXY", "socks5://"+proxyAddr)
+	defer os.Unsetenv("NATS_PROXY")
+
+	os.Setenv("NO_PROXY", "internal.example.com")
+	defer os.Unsetenv("NO_PROXY")
+
+	dial, err := ProxyDialerFromEnvironment(nil)
+	c.Assert(err, IsNil)
+
+	dial("tcp", "nats.example.com:4222")
+	c.Assert(atomic.LoadInt32(requests), Equals, int32(1))
+
+	dial("tcp", "nats.internal.example.com:4222")
+	c.Assert(atomic.LoadInt32(requests), Equals, int32(1))
+
+	conn, err := dial("tcp", "127.0.0.1:4223")
+	c.Assert(err, IsNil)
+	conn.Close()
+
+	c.Assert(atomic.LoadInt32(requests), Equals, int32(1))
+}
+
+func (t *TLSSuite) TestNewTLSConnectionThroughHTTPConnectProxy(c *C) {
+	proxyAddr, _ := startHTTPConnectProxy(c, "")
+
+	dial, err := ProxyDialer(&url.URL{Scheme: "http", Host: proxyAddr}, nil)
+	c.Assert(err, IsNil)
+
+	roots := x509.NewCertPool()
+	ok := roots.AppendCertsFromPEM(ValidCA)
+	c.Assert(ok, Equals, true)
+
+	client := NewClient()
+	defer client.Disconnect()
+
+	err = client.Connect(&ConnectionInfo{Addr: "127.0.0.1:4555",
+		Username: "nats",
+		Password: "nats",
+		Dial:     dial,
+		TLSInfo: &ConnectionTLSInfo{
+			CertPool: roots,
+		},
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(client.Ping(), Equals, true)
+}
+
+// startHTTPConnectProxy answers CONNECT requests, requiring the given
+// Proxy-Authorization unless it is empty. The 200 response is held back
+// until the target has sent something so that both arrive together.
+func startHTTPConnectProxy(c *C, authorization string) (string, *int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	connections := new(int32)
+
+	go func() {
+		defer listener.Close()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				request, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil || request.Method != "CONNECT" {
+					return
+				}
+
+				if authorization != "" && request.Header.Get("Proxy-Authorization") != authorization {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+
+				upstream, err := net.Dial("tcp", request.Host)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+
+				atomic.AddInt32(connections, 1)
+
+				first := make([]byte, 1024)
+				n, err := upstream.Read(first)
+				if err != nil {
+					return
+				}
+
+				conn.Write(append([]byte("HTTP/1.1 200 Connection established\r\n\r\n"), first[:n]...))
+
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), connections
+}
+
+// startSOCKS5Proxy accepts SOCKS5 CONNECT requests, requiring
+// username/password authentication unless user is empty, and counts the
+// requests it receives.
+func startSOCKS5Proxy(c *C, user, pass string) (string, *int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	requests := new(int32)
+
+	go func() {
+		defer listener.Close()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+
+				header := make([]byte, 2)
+				io.ReadFull(reader, header)
+				io.ReadFull(reader, make([]byte, header[1]))
+
+				if user == "" {
+					conn.Write([]byte{5, 0})
+				} else {
+					conn.Write([]byte{5, 2})
+
+					version, _ := reader.ReadByte()
+					if version != 1 {
+						return
+					}
+
+					givenUser := make([]byte, mustReadByte(reader))
+					io.ReadFull(reader, givenUser)
+
+					givenPass := make([]byte, mustReadByte(reader))
+					io.ReadFull(reader, givenPass)
+
+					if string(givenUser) != user || string(givenPass) != pass {
+						conn.Write([]byte{1, 1})
+						return
+					}
+
+					conn.Write([]byte{1, 0})
+				}
+
+				request := make([]byte, 4)
+				io.ReadFull(reader, request)
+
+				var host string
+
+				switch request[3] {
+				case 1:
+					ip := make([]byte, 4)
+					io.ReadFull(reader, ip)
+					host = net.IP(ip).String()
+				case 3:
+					domain := make([]byte, mustReadByte(reader))
+					io.ReadFull(reader, domain)
+					host = string(domain)
+				default:
+					return
+				}
+
+				port := make([]byte, 2)
+				io.ReadFull(reader, port)
+
+				atomic.AddInt32(requests, 1)
+
+				upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go io.Copy(upstream, reader)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return listener.Addr().String(), requests
+}
+
+func mustReadByte(reader *bufio.Reader) byte {
+	b, _ := reader.ReadByte()
+	return b
+}
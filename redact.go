@@ -0,0 +1,143 @@
+package yagnats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+const DefaultMaxLoggedPayload = 128
+
+const redacted = "[REDACTED]"
+
+// Redactor scrubs packets before they are handed to the debug logger. Make
+// one with NewRedactor; the zero value is not usable. Header values are
+// always masked, since they tend to carry credentials.
+type Redactor struct {
+	maxPayload   int
+	hashPayloads bool
+	subjects     []string
+	lock         *sync.RWMutex
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{
+		maxPayload: DefaultMaxLoggedPayload,
+		lock:       &sync.RWMutex{},
+	}
+}
+
+// SetMaxPayload sets the number of payload bytes logged before the rest is
+// cut off, DefaultMaxLoggedPayload by default. A negative value logs
+// payloads in full.
+func (r *Redactor) SetMaxPayload(max int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.maxPayload = max
+}
+
+// SetHashPayloads logs a SHA-256 digest in place of payloads longer than the
+// maximum, and of header values, instead of truncating or redacting them.
+func (r *Redactor) SetHashPayloads(hash bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.hashPayloads = hash
+}
+
+// NeverLogSubject suppresses payloads of messages whose subject matches
+// pattern, which may contain the * and > wildcards.
+func (r *Redactor) NeverLogSubject(pattern string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.subjects = append(r.subjects, pattern)
+}
+
+func (r *Redactor) Redact(packet Packet) Packet {
+	switch p := packet.(type) {
+	case *ConnectPacket:
+		redactedPacket := *p
+		if redactedPacket.Pass != "" {
+			redactedPacket.Pass = redacted
+		}
+
+		return &redactedPacket
+
+	case *PubPacket:
+		redactedPacket := *p
+		redactedPacket.Header = r.header(p.Subject, p.Header)
+		redactedPacket.Payload = r.payload(p.Subject, p.Payload)
+		return &redactedPacket
+
+	case *MsgPacket:
+		redactedPacket := *p
+		redactedPacket.Header = r.header(p.Subject, p.Header)
+		redactedPacket.Payload = r.payload(p.Subject, p.Payload)
+		return &redactedPacket
+	}
+
+	return packet
+}
+
+// header keeps the keys and masks every value, whatever its length.
+func (r *Redactor) header(subject string, header Header) Header {
+	if header == nil {
+		return nil
+	}
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	hash := r.hashPayloads && !r.neverLogged(subject)
+
+	redactedHeader := Header{}
+	for key, values := range header {
+		for _, value := range values {
+			if hash {
+				redactedHeader.Add(key, digest([]byte(value)))
+			} else {
+				redactedHeader.Add(key, redacted)
+			}
+		}
+	}
+
+	return redactedHeader
+}
+
+func (r *Redactor) payload(subject string, payload []byte) []byte {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.neverLogged(subject) {
+		return []byte(redacted)
+	}
+
+	if r.maxPayload < 0 || len(payload) <= r.maxPayload {
+		return payload
+	}
+
+	if r.hashPayloads {
+		return []byte(digest(payload))
+	}
+
+	return []byte(fmt.Sprintf("%s...(%d bytes truncated)", payload[:r.maxPayload], len(payload)-r.maxPayload))
+}
+
+// neverLogged must be called with the lock held.
+func (r *Redactor) neverLogged(subject string) bool {
+	for _, pattern := range r.subjects {
+		if SubjectMatches(pattern, subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package yagnats
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *YSuite) TestRedactorMasksPassword(c *C) {
+	packet := &ConnectPacket{User: "foo", Pass: "bar"}
+
+	redactedPacket := NewRedactor().Redact(packet).(*ConnectPacket)
+
+	c.Assert(redactedPacket.User, Equals, "foo")
+	c.Assert(redactedPacket.Pass, Equals, "[REDACTED]")
+	c.Assert(packet.Pass, Equals, "bar")
+}
+
+func (s *YSuite) TestRedactorTruncatesPayloads(c *C) {
+	redactor := NewRedactor()
+	redactor.SetMaxPayload(4)
+
+	packet := redactor.Redact(&PubPacket{Subject: "foo", Payload: []byte("hello world")}).(*PubPacket)
+	c.Assert(string(packet.Payload), Equals, "hell...(7 bytes truncated)")
+
+	packet = redactor.Redact(&PubPacket{Subject: "foo", Payload: []byte("hi")}).(*PubPacket)
+	c.Assert(string(packet.Payload), Equals, "hi")
+}
+
+func (s *YSuite) TestRedactorHashesPayloads(c *C) {
+	redactor := NewRedactor()
+	redactor.SetMaxPayload(4)
+	redactor.SetHashPayloads(true)
+
+	packet := redactor.Redact(&MsgPacket{Subject: "foo", Payload: []byte("hello world")}).(*MsgPacket)
+	c.Assert(strings.HasPrefix(string(packet.Payload), "sha256:"), Equals, true)
+	c.Assert(len(packet.Payload), Equals, len("sha256:")+64)
+}
+
+func (s *YSuite) TestRedactorNeverLogsSubjects(c *C) {
+	redactor := NewRedactor()
+	redactor.NeverLogSubject("secrets.>")
+	redactor.NeverLogSubject("*.password")
+
+	for _, subject := range []string{"secrets.db", "secrets.db.admin", "user.password"} {
+		packet := redactor.Redact(&PubPacket{Subject: subject, Payload: []byte("x")}).(*PubPacket)
+		c.Check(string(packet.Payload), Equals, "[REDACTED]", Commentf(subject))
+	}
+
+	for _, subject := range []string{"secrets", "user.password.reset"} {
+		packet := redactor.Redact(&PubPacket{Subject: subject, Payload: []byte("x")}).(*PubPacket)
+		c.Check(string(packet.Payload), Equals, "x", Commentf(subject))
+	}
+}
+
+func (s *YSuite) TestRedactorRedactsHeaders(c *C) {
+	redactor := NewRedactor()
+	redactor.SetMaxPayload(4)
+	redactor.NeverLogSubject("secrets.>")
+
+	header := Header{"token": {"abcdefgh"}, "id": {"42"}}
+
+	packet := redactor.Redact(&PubPacket{Subject: "foo", Header: header}).(*PubPacket)
+	c.Assert(packet.Header.Get("token"), Equals, "[REDACTED]")
+	c.Assert(packet.Header.Get("id"), Equals, "[REDACTED]")
+
+	msg := redactor.Redact(&MsgPacket{Subject: "secrets.db", Header: header}).(*MsgPacket)
+	c.Assert(msg.Header.Get("token"), Equals, "[REDACTED]")
+	c.Assert(msg.Header.Get("id"), Equals, "[REDACTED]")
+
+	c.Assert(header.Get("token"), Equals, "abcdefgh")
+}
+
+func (s *YSuite) TestRedactorHashesHeaders(c *C) {
+	redactor := NewRedactor()
+	redactor.SetHashPayloads(true)
+	redactor.NeverLogSubject("secrets.>")
+
+	header := Header{"id": {"42"}}
+
+	packet := redactor.Redact(&PubPacket{Subject: "foo", Header: header}).(*PubPacket)
+	c.Assert(packet.Header.Get("id"), Equals, "sha256:73475cb40a568e8da8a045ced110137e159f890ac4da883b6b17dc651b3a8049")
+
+	packet = redactor.Redact(&PubPacket{Subject: "secrets.db", Header: header}).(*PubPacket)
+	c.Assert(packet.Header.Get("id"), Equals, "[REDACTED]")
+}
+
+func (s *YSuite) TestRedactorCanBeChangedWhileInUse(c *C) {
+	redactor := NewRedactor()
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			redactor.Redact(&PubPacket{Subject: "foo", Payload: []byte("hello world")})
+		}
+		close(done)
+	}()
+
+	for i := 0; i < 100; i++ {
+		redactor.SetMaxPayload(i % 8)
+		redactor.SetHashPayloads(i%2 == 0)
+	}
+
+	<-done
+}
+
+func (s *YSuite) TestSetRedactorNilRestoresTheDefault(c *C) {
+	client := NewClient()
+	client.SetRedactor(nil)
+
+	packet := client.Redactor().Redact(&ConnectPacket{Pass: "bar"}).(*ConnectPacket)
+	c.Assert(packet.Pass, Equals, "[REDACTED]")
+
+	conn := NewConnection("127.0.0.1:4222", "", "")
+	conn.SetRedactor(nil)
+
+	packet = conn.Redactor().Redact(&ConnectPacket{Pass: "bar"}).(*ConnectPacket)
+	c.Assert(packet.Pass, Equals, "[REDACTED]")
+}
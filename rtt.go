@@ -0,0 +1,111 @@
+package yagnats
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const rttWindowSize = 128
+
+var rttBucketBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Duration(math.MaxInt64),
+}
+
+type RTTHistogram struct {
+	Count   int
+	Last    time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+	Buckets []RTTBucket
+}
+
+type RTTBucket struct {
+	UpperBound time.Duration
+	Count      int
+}
+
+type rttWindow struct {
+	samples []time.Duration
+	next    int
+	last    time.Duration
+
+	lock *sync.Mutex
+}
+
+func newRTTWindow() *rttWindow {
+	return &rttWindow{
+		samples: make([]time.Duration, 0, rttWindowSize),
+		lock:    &sync.Mutex{},
+	}
+}
+
+func (w *rttWindow) record(rtt time.Duration) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.last = rtt
+
+	if len(w.samples) < rttWindowSize {
+		w.samples = append(w.samples, rtt)
+		return
+	}
+
+	w.samples[w.next] = rtt
+	w.next = (w.next + 1) % rttWindowSize
+}
+
+func (w *rttWindow) histogram() RTTHistogram {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	histogram := RTTHistogram{
+		Count:   len(w.samples),
+		Last:    w.last,
+		Buckets: make([]RTTBucket, len(rttBucketBounds)),
+	}
+
+	for i, bound := range rttBucketBounds {
+		histogram.Buckets[i].UpperBound = bound
+	}
+
+	if len(w.samples) == 0 {
+		return histogram
+	}
+
+	var total time.Duration
+
+	histogram.Min = w.samples[0]
+
+	for _, rtt := range w.samples {
+		total += rtt
+
+		if rtt < histogram.Min {
+			histogram.Min = rtt
+		}
+
+		if rtt > histogram.Max {
+			histogram.Max = rtt
+		}
+
+		for i, bound := range rttBucketBounds {
+			if rtt <= bound {
+				histogram.Buckets[i].Count++
+				break
+			}
+		}
+	}
+
+	histogram.Mean = total / time.Duration(len(w.samples))
+
+	return histogram
+}
@@ -0,0 +1,70 @@
+package yagnats
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+type Statistics struct {
+	InMsgs     uint64
+	OutMsgs    uint64
+	InBytes    uint64
+	OutBytes   uint64
+	Reconnects uint64
+	LastError  error
+
+	Subscriptions []SubscriptionStatistics
+}
+
+type SubscriptionStatistics struct {
+	ID      int64
+	Subject string
+	Queue   string
+
+	Delivered uint64
+	Dropped   uint64
+	Pending   int64
+}
+
+func (s *Subscription) Statistics() SubscriptionStatistics {
+	return SubscriptionStatistics{
+		ID:      s.ID,
+		Subject: s.Subject,
+		Queue:   s.Queue,
+
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Dropped:   atomic.LoadUint64(&s.dropped),
+		Pending:   atomic.LoadInt64(&s.pending),
+	}
+}
+
+func (c *Client) Statistics() Statistics {
+	c.lock.Lock()
+	stats := Statistics{
+		LastError:     c.lastError,
+		Subscriptions: make([]SubscriptionStatistics, 0, len(c.subscriptions)),
+	}
+
+	for _, sub := range c.subscriptions {
+		stats.Subscriptions = append(stats.Subscriptions, sub.Statistics())
+	}
+	c.lock.Unlock()
+
+	sort.Slice(stats.Subscriptions, func(i, j int) bool {
+		return stats.Subscriptions[i].ID < stats.Subscriptions[j].ID
+	})
+
+	stats.InMsgs = atomic.LoadUint64(&c.inMsgs)
+	stats.OutMsgs = atomic.LoadUint64(&c.outMsgs)
+	stats.InBytes = atomic.LoadUint64(&c.inBytes)
+	stats.OutBytes = atomic.LoadUint64(&c.outBytes)
+	stats.Reconnects = atomic.LoadUint64(&c.reconnects)
+
+	return stats
+}
+
+func (c *Client) recordError(err error) {
+	c.lock.Lock()
+	c.lastError = err
+	c.lock.Unlock()
+}
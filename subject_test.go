@@ -0,0 +1,21 @@
+package yagnats
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *YSuite) TestSubjectMatches(c *C) {
+	c.Assert(SubjectMatches("foo.bar", "foo.bar"), Equals, true)
+	c.Assert(SubjectMatches("foo.bar", "foo.baz"), Equals, false)
+	c.Assert(SubjectMatches("foo.bar", "foo.bar.baz"), Equals, false)
+
+	c.Assert(SubjectMatches("foo.*", "foo.bar"), Equals, true)
+	c.Assert(SubjectMatches("foo.*", "foo"), Equals, false)
+	c.Assert(SubjectMatches("foo.*", "foo.bar.baz"), Equals, false)
+	c.Assert(SubjectMatches("*.bar", "foo.bar"), Equals, true)
+
+	c.Assert(SubjectMatches("foo.>", "foo.bar"), Equals, true)
+	c.Assert(SubjectMatches("foo.>", "foo.bar.baz"), Equals, true)
+	c.Assert(SubjectMatches("foo.>", "foo"), Equals, false)
+	c.Assert(SubjectMatches(">", "foo"), Equals, true)
+}
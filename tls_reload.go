@@ -0,0 +1,178 @@
+package yagnats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a client certificate and CA pool read from files,
+// rereading them whenever one of the files changes on disk.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	versions map[string]fileVersion
+	lock     *sync.Mutex
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func newCertReloader(certFile, keyFile, caFile string) *certReloader {
+	return &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		versions: map[string]fileVersion{},
+		lock:     &sync.Mutex{},
+	}
+}
+
+// tlsConfig verifies servers against the CA file as it is now. The client
+// certificate is reread on every handshake.
+func (r *certReloader) tlsConfig(verifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) (*tls.Config, error) {
+	pool, err := r.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		RootCAs:               pool,
+		GetClientCertificate:  r.getClientCertificate,
+		VerifyPeerCertificate: verifyPeerCertificate,
+	}, nil
+}
+
+// reload rereads the files if any of them changed since they were last read
+// and reports whether they did. On error the previous credentials are kept.
+func (r *certReloader) reload() (bool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	versions := map[string]fileVersion{}
+	changed := false
+
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+
+		version := fileVersion{modTime: info.ModTime(), size: info.Size()}
+		if r.versions[file] != version {
+			changed = true
+		}
+
+		versions[file] = version
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+
+	if r.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return false, err
+		}
+
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+
+	if r.caFile != "" {
+		ca, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return false, err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return false, errors.New("no certificates found in " + r.caFile)
+		}
+	}
+
+	r.cert = cert
+	r.pool = pool
+	r.versions = versions
+
+	return true, nil
+}
+
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool, error) {
+	_, err := r.reload()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// a failed reload mid-rotation falls back to what was loaded before
+	if err != nil && len(r.versions) == 0 {
+		return nil, nil, err
+	}
+
+	return r.cert, r.pool, nil
+}
+
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, _, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+
+	if cert == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return cert, nil
+}
+
+// rootCAs returns the pool read from the CA file, or nil for the system
+// roots when there is none.
+func (r *certReloader) rootCAs() (*x509.CertPool, error) {
+	_, pool, err := r.current()
+	return pool, err
+}
+
+// reconnectOnRotation closes the connection once the files change so that
+// the client reconnects with the new credentials.
+func (c *Connection) reconnectOnRotation(reloader *certReloader, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			changed, err := reloader.reload()
+			if err != nil {
+				c.Logger().Warnd(map[string]interface{}{"error": err.Error()}, "connection.tls.reload-failed")
+				continue
+			}
+
+			if changed {
+				c.Logger().Info("connection.tls.rotated")
+				c.Disconnect()
+				return
+			}
+
+		case <-c.Disconnected:
+			return
+		}
+	}
+}
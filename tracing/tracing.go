@@ -0,0 +1,281 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+	nats "github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/cloudfoundry/yagnats/tracing"
+
+// envelopePrefix starts payloads that carry trace context for servers
+// without header support.
+const envelopePrefix = "YAGNATS-TRACE/1.0\r\n"
+
+type Options struct {
+	// TracerProvider defaults to the global provider.
+	TracerProvider trace.TracerProvider
+
+	// Propagator defaults to W3C trace context.
+	Propagator propagation.TextMapPropagator
+}
+
+type headerCarrier yagnats.Header
+
+func (c headerCarrier) Get(key string) string {
+	return yagnats.Header(c).Get(key)
+}
+
+func (c headerCarrier) Set(key, value string) {
+	yagnats.Header(c).Set(key, value)
+}
+
+func (c headerCarrier) Keys() []string {
+	return yagnats.Header(c).Keys()
+}
+
+// tracer returns the configured tracer and propagator, or the defaults.
+func (o Options) tracer() (trace.Tracer, propagation.TextMapPropagator) {
+	provider := o.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	propagator := o.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	return provider.Tracer(instrumentationName), propagator
+}
+
+// InstrumentClient starts a producer span for every message published by
+// client and a consumer span around every subscription callback, carrying
+// trace context between them in message headers, or in a payload envelope
+// on connections to servers without header support.
+func InstrumentClient(client *yagnats.Client, options Options) {
+	tracer, propagator := options.tracer()
+
+	client.AddPublishMiddleware(func(next yagnats.PublishFunc) yagnats.PublishFunc {
+		return func(msg *yagnats.Message) error {
+			ctx, span := tracer.Start(
+				msg.Context(),
+				msg.Subject+" publish",
+				trace.WithSpanKind(trace.SpanKindProducer),
+				trace.WithAttributes(attributes(msg, "publish")...),
+			)
+			defer span.End()
+
+			carrier := headerCarrier{}
+			propagator.Inject(ctx, carrier)
+
+			// the client folds the headers into a payload envelope if the
+			// connection the message goes out on has no header support
+			traced := msg.WithContext(yagnats.WithHeaderFallback(ctx, wrapEnvelope))
+
+			traced.Header = yagnats.Header{}
+			for key, values := range msg.Header {
+				traced.Header[key] = values
+			}
+
+			for key, values := range carrier {
+				traced.Header[key] = values
+			}
+
+			err := next(traced)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return err
+		}
+	})
+
+	client.AddCallbackMiddleware(func(next yagnats.Callback) yagnats.Callback {
+		return func(msg *yagnats.Message) {
+			carrier := headerCarrier(msg.Header)
+
+			header, payload, ok := unwrapEnvelope(msg.Payload)
+			if ok {
+				carrier = headerCarrier(header)
+
+				unwrapped := *msg
+				unwrapped.Header = header
+				unwrapped.Payload = payload
+				msg = &unwrapped
+			}
+
+			if carrier == nil {
+				carrier = headerCarrier{}
+			}
+
+			ctx := propagator.Extract(msg.Context(), carrier)
+
+			ctx, span := tracer.Start(
+				ctx,
+				msg.Subject+" process",
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(attributes(msg, "process")...),
+			)
+			defer span.End()
+
+			next(msg.WithContext(ctx))
+		}
+	})
+}
+
+// InstrumentConn returns conn with a producer span started for every
+// Request and RequestWithContext, carrying trace context to the responder in
+// the request's headers. Requests go out in the payload envelope instead
+// when the server has no header support, or when conn is neither from
+// Connect nor from NATSConnFromClient. Pass it to yagnats.WithConnWrapper to
+// instrument connections made by Connect.
+func InstrumentConn(conn yagnats.NATSConn, options Options) yagnats.NATSConn {
+	tracer, propagator := options.tracer()
+
+	return &tracedConn{
+		NATSConn:   conn,
+		tracer:     tracer,
+		propagator: propagator,
+	}
+}
+
+type tracedConn struct {
+	yagnats.NATSConn
+
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// msgRequester is implemented by nats.Conn and by NATSConnFromClient.
+type msgRequester interface {
+	RequestMsgWithContext(ctx context.Context, msg *nats.Msg) (*nats.Msg, error)
+}
+
+func (c *tracedConn) Request(subject string, data []byte, timeout time.Duration) (*nats.Msg, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	msg, err := c.RequestWithContext(ctx, subject, data)
+	if err == context.DeadlineExceeded {
+		return nil, nats.ErrTimeout
+	}
+
+	return msg, err
+}
+
+func (c *tracedConn) RequestWithContext(ctx context.Context, subject string, data []byte) (*nats.Msg, error) {
+	request := &yagnats.Message{Subject: subject, Payload: data}
+
+	ctx, span := c.tracer.Start(
+		ctx,
+		subject+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attributes(request, "publish")...),
+	)
+	defer span.End()
+
+	header := yagnats.Header{}
+	c.propagator.Inject(ctx, headerCarrier(header))
+
+	reply, err := c.request(ctx, subject, header, data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return reply, err
+}
+
+func (c *tracedConn) request(ctx context.Context, subject string, header yagnats.Header, data []byte) (*nats.Msg, error) {
+	requester, ok := c.NATSConn.(msgRequester)
+	if !ok {
+		return c.NATSConn.RequestWithContext(ctx, subject, wrapEnvelope(header, data))
+	}
+
+	msg := &nats.Msg{Subject: subject, Header: nats.Header(header), Data: data}
+
+	// a Client folds the headers into the envelope itself, nats.go refuses
+	reply, err := requester.RequestMsgWithContext(yagnats.WithHeaderFallback(ctx, wrapEnvelope), msg)
+	if err == nats.ErrHeadersNotSupported {
+		return c.NATSConn.RequestWithContext(ctx, subject, wrapEnvelope(header, data))
+	}
+
+	return reply, err
+}
+
+func attributes(msg *yagnats.Message, operation string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "nats"),
+		attribute.String("messaging.operation", operation),
+		attribute.String("messaging.destination.name", msg.Subject),
+		attribute.Int("messaging.message.body.size", len(msg.Payload)),
+	}
+
+	if msg.ReplyTo != "" {
+		attrs = append(attrs, attribute.String("messaging.nats.reply_to", msg.ReplyTo))
+	}
+
+	return attrs
+}
+
+func wrapEnvelope(header yagnats.Header, payload []byte) []byte {
+	buf := new(bytes.Buffer)
+
+	buf.WriteString(envelopePrefix)
+
+	for _, key := range header.Keys() {
+		for _, value := range header[key] {
+			buf.WriteString(key + ": " + value + "\r\n")
+		}
+	}
+
+	buf.WriteString("\r\n")
+	buf.Write(payload)
+
+	return buf.Bytes()
+}
+
+func unwrapEnvelope(data []byte) (yagnats.Header, []byte, bool) {
+	if !bytes.HasPrefix(data, []byte(envelopePrefix)) {
+		return nil, nil, false
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data[len(envelopePrefix):]))
+	header := yagnats.Header{}
+	consumed := len(envelopePrefix)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, false
+		}
+
+		consumed += len(line)
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, nil, false
+		}
+
+		header.Add(line[:colon], strings.TrimSpace(line[colon+1:]))
+	}
+
+	return header, data[consumed:], true
+}
@@ -0,0 +1,349 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracePropagatesThroughHeaders(t *testing.T) {
+	testTracePropagation(t, true)
+}
+
+func TestTracePropagatesThroughPayloadEnvelope(t *testing.T) {
+	testTracePropagation(t, false)
+}
+
+func testTracePropagation(t *testing.T, headers bool) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	client := connect(t, headers)
+	defer client.Disconnect()
+
+	InstrumentClient(client, Options{TracerProvider: provider})
+
+	received := make(chan *yagnats.Message, 1)
+
+	_, err := client.Subscribe("some.subject", func(msg *yagnats.Message) {
+		received <- msg
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	msg := &yagnats.Message{Subject: "some.subject", Payload: []byte("hello")}
+
+	err = client.PublishMsg(msg.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent.End()
+
+	var delivered *yagnats.Message
+
+	select {
+	case delivered = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	if string(delivered.Payload) != "hello" {
+		t.Fatalf("expected payload %q, got %q", "hello", delivered.Payload)
+	}
+
+	if delivered.Header.Get("traceparent") == "" {
+		t.Fatal("expected a traceparent header")
+	}
+
+	consumerContext := trace.SpanContextFromContext(delivered.Context())
+	if consumerContext.TraceID() != parent.SpanContext().TraceID() {
+		t.Fatal("expected callback context to continue the publisher's trace")
+	}
+
+	spans := waitForSpans(exporter, 3)
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+
+	producer := byName["some.subject publish"]
+	consumer := byName["some.subject process"]
+
+	if producer.SpanKind != trace.SpanKindProducer {
+		t.Fatalf("expected a producer span, got %v", producer.SpanKind)
+	}
+
+	if producer.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected producer span to be a child of the caller's span")
+	}
+
+	if consumer.SpanKind != trace.SpanKindConsumer {
+		t.Fatalf("expected a consumer span, got %v", consumer.SpanKind)
+	}
+
+	if consumer.Parent.SpanID() != producer.SpanContext.SpanID() {
+		t.Fatal("expected consumer span to be a child of the producer span")
+	}
+}
+
+func TestRequestThroughAdapterContinuesTheTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	client := connect(t, true)
+	defer client.Disconnect()
+
+	InstrumentClient(client, Options{TracerProvider: provider})
+
+	respond(t, client)
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	response, err := yagnats.NATSConnFromClient(client).RequestWithContext(ctx, "some.service", []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent.End()
+
+	if response.Header.Get("traceparent") == "" {
+		t.Fatal("expected the responder to see a traceparent header")
+	}
+
+	spans := waitForSpans(exporter, 4)
+
+	var producer, consumer tracetest.SpanStub
+	for _, span := range spans {
+		switch span.Name {
+		case "some.service publish":
+			producer = span
+		case "some.service process":
+			consumer = span
+		}
+	}
+
+	if producer.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected the request span to be a child of the caller's span")
+	}
+
+	if consumer.Parent.SpanID() != producer.SpanContext.SpanID() {
+		t.Fatal("expected the responder's span to be a child of the request span")
+	}
+}
+
+func TestInstrumentConnTracesRequestsInHeaders(t *testing.T) {
+	testInstrumentConn(t, true)
+}
+
+func TestInstrumentConnTracesRequestsInPayloadEnvelope(t *testing.T) {
+	testInstrumentConn(t, false)
+}
+
+func testInstrumentConn(t *testing.T, headers bool) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	client := connect(t, headers)
+	defer client.Disconnect()
+
+	respond(t, client)
+
+	conn := InstrumentConn(yagnats.NATSConnFromClient(client), Options{TracerProvider: provider})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+
+	response, err := conn.RequestWithContext(ctx, "some.service", []byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent.End()
+
+	header, payload := yagnats.Header(response.Header), response.Data
+	if !headers {
+		var ok bool
+
+		header, payload, ok = unwrapEnvelope(response.Data)
+		if !ok {
+			t.Fatalf("expected the request in a payload envelope, got %q", response.Data)
+		}
+	}
+
+	if string(payload) != "ping" {
+		t.Fatalf("expected payload %q, got %q", "ping", payload)
+	}
+
+	spans := waitForSpans(exporter, 2)
+
+	var producer tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == "some.service publish" {
+			producer = span
+		}
+	}
+
+	if producer.SpanKind != trace.SpanKindProducer {
+		t.Fatalf("expected a producer span, got %v", producer.SpanKind)
+	}
+
+	if producer.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected the request span to be a child of the caller's span")
+	}
+
+	expected := fmt.Sprintf("00-%s-%s-01", producer.SpanContext.TraceID(), producer.SpanContext.SpanID())
+	if header.Get("traceparent") != expected {
+		t.Fatalf("expected traceparent %q, got %q", expected, header.Get("traceparent"))
+	}
+}
+
+// respond answers requests to some.service with the request's own headers
+// and payload.
+func respond(t *testing.T, client *yagnats.Client) {
+	_, err := client.Subscribe("some.service", func(msg *yagnats.Message) {
+		client.PublishMsg(&yagnats.Message{
+			Subject: msg.ReplyTo,
+			Header:  msg.Header,
+			Payload: msg.Payload,
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUntracedPayloadsAreDeliveredUnchanged(t *testing.T) {
+	header, payload, ok := unwrapEnvelope([]byte("plain payload"))
+	if ok || header != nil || payload != nil {
+		t.Fatal("expected plain payload not to be treated as an envelope")
+	}
+
+	wrapped := wrapEnvelope(yagnats.Header{"traceparent": {"abc"}}, []byte("body"))
+
+	header, payload, ok = unwrapEnvelope(wrapped)
+	if !ok {
+		t.Fatal("expected envelope to be recognised")
+	}
+
+	if header.Get("traceparent") != "abc" || string(payload) != "body" {
+		t.Fatalf("unexpected envelope contents: %v %q", header, payload)
+	}
+}
+
+func waitForSpans(exporter *tracetest.InMemoryExporter, count int) tracetest.SpanStubs {
+	deadline := time.Now().Add(time.Second)
+
+	for time.Now().Before(deadline) {
+		spans := exporter.GetSpans()
+		if len(spans) >= count {
+			return spans
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return exporter.GetSpans()
+}
+
+func connect(t *testing.T, headers bool) *yagnats.Client {
+	client := yagnats.NewClient()
+
+	clientSide, serverSide := net.Pipe()
+	go serveFakeNATS(serverSide, headers)
+
+	err := client.Connect(&yagnats.ConnectionInfo{
+		Addr: "127.0.0.1:4222",
+		Dial: func(network, address string) (net.Conn, error) {
+			return clientSide, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+// serveFakeNATS answers just enough of the protocol for a verbose client,
+// echoing PUB and HPUB back as MSG and HMSG to subscribers, reply subject
+// included.
+func serveFakeNATS(conn net.Conn, headers bool) {
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"headers\":%v}\r\n", headers)
+
+	reader := bufio.NewReader(conn)
+	sids := map[string]string{}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+
+		case "SUB":
+			sids[fields[1]] = fields[len(fields)-1]
+			io.WriteString(conn, "+OK\r\n")
+
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			io.ReadFull(reader, payload)
+
+			io.WriteString(conn, "+OK\r\n")
+
+			if sid, ok := sids[fields[1]]; ok {
+				fmt.Fprintf(conn, "MSG %s %s %s%d\r\n%s", fields[1], sid, reply(fields, 4), size, payload)
+			}
+
+		case "HPUB":
+			headerSize := fields[len(fields)-2]
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			io.ReadFull(reader, payload)
+
+			io.WriteString(conn, "+OK\r\n")
+
+			if sid, ok := sids[fields[1]]; ok {
+				fmt.Fprintf(conn, "HMSG %s %s %s%s %d\r\n%s", fields[1], sid, reply(fields, 5), headerSize, size, payload)
+			}
+
+		default:
+			io.WriteString(conn, "+OK\r\n")
+		}
+	}
+}
+
+// reply returns the reply subject of a PUB or HPUB line followed by a space,
+// or nothing when the line has fewer than withReply fields.
+func reply(fields []string, withReply int) string {
+	if len(fields) < withReply {
+		return ""
+	}
+
+	return fields[2] + " "
+}
@@ -0,0 +1,121 @@
+package yagnats
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func isWebSocketURL(addr string) bool {
+	return strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://")
+}
+
+// WebSocketDialer returns a dial function for ConnectionInfo.Dial that
+// connects to url and carries the NATS protocol in binary WebSocket
+// messages. The network and address it is called with are ignored. netDial,
+// when set, opens the underlying TCP connection.
+func WebSocketDialer(url string, tlsConfig *tls.Config, netDial func(network, address string) (net.Conn, error)) func(network, address string) (net.Conn, error) {
+	return func(string, string) (net.Conn, error) {
+		dialer := &websocket.Dialer{
+			HandshakeTimeout: 5 * time.Second,
+			TLSClientConfig:  tlsConfig,
+			NetDial:          netDial,
+		}
+
+		ws, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return newWebSocketConn(ws), nil
+	}
+}
+
+// webSocketConn adapts a WebSocket to net.Conn. The NATS protocol is a byte
+// stream, so message boundaries are ignored on read.
+type webSocketConn struct {
+	ws *websocket.Conn
+
+	reader io.Reader
+
+	writeLock *sync.Mutex
+}
+
+func newWebSocketConn(ws *websocket.Conn) *webSocketConn {
+	return &webSocketConn{
+		ws:        ws,
+		writeLock: &sync.Mutex{},
+	}
+}
+
+func (c *webSocketConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+
+			if n == 0 {
+				continue
+			}
+
+			err = nil
+		}
+
+		return n, err
+	}
+}
+
+func (c *webSocketConn) Write(b []byte) (int, error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	err := c.ws.WriteMessage(websocket.BinaryMessage, b)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *webSocketConn) Close() error {
+	return c.ws.Close()
+}
+
+func (c *webSocketConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *webSocketConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *webSocketConn) SetDeadline(t time.Time) error {
+	err := c.ws.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *webSocketConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *webSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
@@ -0,0 +1,139 @@
+package yagnats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	. "gopkg.in/check.v1"
+)
+
+func (s *YSuite) TestClientOverWebSocket(c *C) {
+	server := httptest.NewServer(webSocketBridge("127.0.0.1:4223"))
+	defer server.Close()
+
+	client := s.newClient()
+
+	err := client.Connect(&ConnectionInfo{
+		Addr:     "ws://" + server.Listener.Addr().String(),
+		Username: "nats",
+		Password: "nats",
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	payload := make(chan []byte)
+
+	client.Subscribe("some.subject", func(msg *Message) {
+		payload <- msg.Payload
+	})
+
+	client.Publish("some.subject", []byte(strings.Repeat("hello!", 1000)))
+
+	waitReceive(c, strings.Repeat("hello!", 1000), payload, 500)
+}
+
+func (s *YSuite) TestClientOverSecureWebSocket(c *C) {
+	server := httptest.NewTLSServer(webSocketBridge("127.0.0.1:4223"))
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	client := s.newClient()
+
+	err := client.Connect(&ConnectionInfo{
+		Addr:     "wss://" + server.Listener.Addr().String(),
+		Username: "nats",
+		Password: "nats",
+		TLSInfo: &ConnectionTLSInfo{
+			TLSConfig: &tls.Config{RootCAs: roots},
+		},
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	c.Assert(client.Ping(), Equals, true)
+}
+
+func (s *YSuite) TestClientOverWebSocketWithCustomDial(c *C) {
+	server := httptest.NewServer(webSocketBridge("127.0.0.1:4223"))
+	defer server.Close()
+
+	var dialed string
+
+	client := s.newClient()
+
+	err := client.Connect(&ConnectionInfo{
+		Addr:     "ws://nats.example.com/",
+		Username: "nats",
+		Password: "nats",
+		Dial: func(network, address string) (net.Conn, error) {
+			dialed = address
+			return net.Dial("tcp", server.Listener.Addr().String())
+		},
+	})
+	c.Assert(err, IsNil)
+	defer client.Disconnect()
+
+	c.Assert(dialed, Equals, "nats.example.com:80")
+	c.Assert(client.Ping(), Equals, true)
+}
+
+// webSocketBridge accepts WebSocket connections and relays their messages
+// to and from a NATS server at addr.
+func webSocketBridge(addr string) http.Handler {
+	upgrader := websocket.Upgrader{}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		nats, err := net.Dial("tcp", addr)
+		if err != nil {
+			ws.Close()
+			return
+		}
+
+		go func() {
+			defer ws.Close()
+
+			buf := make([]byte, 1024)
+			for {
+				n, err := nats.Read(buf)
+				if err != nil {
+					return
+				}
+
+				// split across messages to exercise reassembly
+				for _, chunk := range [][]byte{buf[:n/2], buf[n/2 : n]} {
+					err = ws.WriteMessage(websocket.BinaryMessage, chunk)
+					if err != nil {
+						return
+					}
+				}
+			}
+		}()
+
+		defer nats.Close()
+
+		for {
+			_, reader, err := ws.NextReader()
+			if err != nil {
+				return
+			}
+
+			_, err = io.Copy(nats, reader)
+			if err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package yagnatstest
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+	"github.com/cloudfoundry/yagnats/assets"
+	"github.com/cloudfoundry/yagnats/internal/natsserver"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+var ErrNATSServerNotReady = natsserver.ErrNotReady
+
+const natsServerReadyTimeout = 10 * time.Second
+
+type NATSServerOptions struct {
+	// Username and Password, when set, are required from clients.
+	Username string
+	Password string
+
+	// TLS, when set, makes the server require TLS from clients.
+	TLS *TLSFiles
+
+	// LameDuckDuration defaults to 2s and LameDuckGracePeriod to 500ms. The
+	// grace period is how long clients have after the lame duck
+	// announcement before the server starts closing their connections.
+	LameDuckDuration    time.Duration
+	LameDuckGracePeriod time.Duration
+}
+
+type TLSFiles struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	// ClientCertFile and ClientKeyFile, when set, make the server verify
+	// client certificates against CAFile and are presented by the
+	// ConnectionInfo it returns.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// AssetsTLSFiles writes the certificates embedded from this repository's
+// assets directory, which are valid for 127.0.0.1, into dir.
+func AssetsTLSFiles(dir string, mutual bool) (*TLSFiles, error) {
+	files := &TLSFiles{
+		CertFile: filepath.Join(dir, "server-cert.pem"),
+		KeyFile:  filepath.Join(dir, "server-pkey.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+
+	paths := []string{files.CertFile, files.KeyFile, files.CAFile}
+
+	if mutual {
+		files.ClientCertFile = filepath.Join(dir, "client-cert.pem")
+		files.ClientKeyFile = filepath.Join(dir, "client-pkey.pem")
+
+		paths = append(paths, files.ClientCertFile, files.ClientKeyFile)
+	}
+
+	for _, path := range paths {
+		contents, err := assets.FS.ReadFile(filepath.Base(path))
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.WriteFile(path, contents, 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// NATSServer is a nats-server running in the test process on a random
+// loopback port.
+type NATSServer struct {
+	*server.Server
+
+	options NATSServerOptions
+}
+
+func StartNATSServer(options NATSServerOptions) (*NATSServer, error) {
+	return startNATSServer(options, nil)
+}
+
+// StartNATSCluster starts nodes servers routed to each other and waits for
+// the routes to be up.
+func StartNATSCluster(nodes int, options NATSServerOptions) ([]*NATSServer, error) {
+	servers := []*NATSServer{}
+
+	for i := 0; i < nodes; i++ {
+		var routes []*url.URL
+		if i > 0 {
+			routes = []*url.URL{{Scheme: "nats", Host: servers[0].ClusterAddr().String()}}
+		}
+
+		s, err := startNATSServer(options, &server.ClusterOpts{
+			Name: "yagnatstest",
+			Host: "127.0.0.1",
+			Port: -1,
+		}, routes...)
+		if err != nil {
+			ShutdownNATSCluster(servers)
+			return nil, err
+		}
+
+		servers = append(servers, s)
+	}
+
+	deadline := time.Now().Add(natsServerReadyTimeout)
+
+	for _, s := range servers {
+		for s.NumRoutes() < nodes-1 {
+			if time.Now().After(deadline) {
+				ShutdownNATSCluster(servers)
+				return nil, ErrNATSServerNotReady
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return servers, nil
+}
+
+func ShutdownNATSCluster(servers []*NATSServer) {
+	for _, s := range servers {
+		s.Shutdown()
+	}
+}
+
+// ClusterConnectionProvider connects to the first reachable server.
+func ClusterConnectionProvider(servers []*NATSServer) *yagnats.ConnectionCluster {
+	cluster := &yagnats.ConnectionCluster{}
+	for _, s := range servers {
+		cluster.Members = append(cluster.Members, s.ConnectionInfo())
+	}
+
+	return cluster
+}
+
+func ClusterURLs(servers []*NATSServer) []string {
+	urls := []string{}
+	for _, s := range servers {
+		urls = append(urls, s.URL())
+	}
+
+	return urls
+}
+
+func startNATSServer(options NATSServerOptions, cluster *server.ClusterOpts, routes ...*url.URL) (*NATSServer, error) {
+	opts := &server.Options{
+		Host:     "127.0.0.1",
+		Port:     server.RANDOM_PORT,
+		Username: options.Username,
+		Password: options.Password,
+
+		LameDuckDuration:    options.LameDuckDuration,
+		LameDuckGracePeriod: options.LameDuckGracePeriod,
+
+		Routes: routes,
+	}
+
+	if opts.LameDuckDuration == 0 {
+		opts.LameDuckDuration = 2 * time.Second
+	}
+
+	if opts.LameDuckGracePeriod == 0 {
+		opts.LameDuckGracePeriod = 500 * time.Millisecond
+	}
+
+	if cluster != nil {
+		opts.Cluster = *cluster
+	}
+
+	if options.TLS != nil {
+		config, err := server.GenTLSConfig(&server.TLSConfigOpts{
+			CertFile: options.TLS.CertFile,
+			KeyFile:  options.TLS.KeyFile,
+			CaFile:   options.TLS.CAFile,
+			Verify:   options.TLS.ClientCertFile != "",
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		opts.TLS = true
+		opts.TLSVerify = options.TLS.ClientCertFile != ""
+		opts.TLSConfig = config
+		opts.TLSTimeout = 2
+	}
+
+	s, err := natsserver.Start(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATSServer{Server: s, options: options}, nil
+}
+
+// Addr returns the host:port clients connect to.
+func (s *NATSServer) Addr() string {
+	addr := s.Server.Addr().(*net.TCPAddr)
+	return net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port))
+}
+
+// URL returns the client URL, with credentials when the server requires
+// them, for nats.go based connections.
+func (s *NATSServer) URL() string {
+	u := &url.URL{Scheme: "nats", Host: s.Addr()}
+	if s.options.TLS != nil {
+		u.Scheme = "tls"
+	}
+
+	if s.options.Username != "" || s.options.Password != "" {
+		u.User = url.UserPassword(s.options.Username, s.options.Password)
+	}
+
+	return u.String()
+}
+
+func (s *NATSServer) ConnectionInfo() *yagnats.ConnectionInfo {
+	info := &yagnats.ConnectionInfo{
+		Addr:     s.Addr(),
+		Username: s.options.Username,
+		Password: s.options.Password,
+	}
+
+	if s.options.TLS != nil {
+		info.TLSInfo = &yagnats.ConnectionTLSInfo{
+			CAFile:   s.options.TLS.CAFile,
+			CertFile: s.options.TLS.ClientCertFile,
+			KeyFile:  s.options.TLS.ClientKeyFile,
+		}
+	}
+
+	return info
+}
+
+// LameDuck puts the server into lame duck mode: it stops accepting clients,
+// announces lame duck mode to the connected ones and, after the grace
+// period, closes their connections and shuts down. It does not wait.
+func (s *NATSServer) LameDuck() {
+	go s.LameDuckShutdown()
+}
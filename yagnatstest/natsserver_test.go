@@ -0,0 +1,149 @@
+package yagnatstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+)
+
+func startNATSServerForTest(t *testing.T, options NATSServerOptions) *NATSServer {
+	s, err := StartNATSServer(options)
+	if err != nil {
+		t.Fatalf("failed to start nats-server: %s", err)
+	}
+
+	t.Cleanup(s.Shutdown)
+
+	return s
+}
+
+func connectTo(t *testing.T, cp yagnats.ConnectionProvider) *yagnats.Client {
+	client := yagnats.NewClient()
+
+	err := client.Connect(cp)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+
+	t.Cleanup(client.Disconnect)
+
+	return client
+}
+
+func assertRoundTrip(t *testing.T, subscriber, publisher *yagnats.Client) {
+	messages := make(chan *yagnats.Message, 1)
+
+	_, err := subscriber.Subscribe("foo", func(msg *yagnats.Message) {
+		messages <- msg
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+
+	// the subscription reaches other cluster nodes asynchronously
+	deadline := time.After(5 * time.Second)
+	for {
+		err = publisher.Publish("foo", []byte("hello"))
+		if err != nil {
+			t.Fatalf("failed to publish: %s", err)
+		}
+
+		select {
+		case msg := <-messages:
+			if string(msg.Payload) != "hello" {
+				t.Errorf("unexpected payload %q", msg.Payload)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("did not receive a message")
+		}
+	}
+}
+
+func TestNATSServerWithAuth(t *testing.T) {
+	s := startNATSServerForTest(t, NATSServerOptions{Username: "nats", Password: "secret"})
+
+	client := connectTo(t, s.ConnectionInfo())
+	assertRoundTrip(t, client, client)
+
+	err := yagnats.NewClient().Connect(&yagnats.ConnectionInfo{Addr: s.Addr()})
+	if err == nil {
+		t.Error("expected connecting without credentials to fail")
+	}
+
+	conn, err := yagnats.Connect([]string{s.URL()})
+	if err != nil {
+		t.Fatalf("failed to connect with nats.go: %s", err)
+	}
+	conn.Close()
+}
+
+func TestNATSServerWithMutualTLS(t *testing.T) {
+	files, err := AssetsTLSFiles(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("failed to write the TLS assets: %s", err)
+	}
+
+	s := startNATSServerForTest(t, NATSServerOptions{TLS: files})
+
+	client := connectTo(t, s.ConnectionInfo())
+	assertRoundTrip(t, client, client)
+
+	info := s.ConnectionInfo()
+	info.TLSInfo.CertFile = ""
+	info.TLSInfo.KeyFile = ""
+
+	client = yagnats.NewClient()
+	if client.Connect(info) == nil {
+		client.Disconnect()
+		t.Error("expected connecting without a client certificate to fail")
+	}
+}
+
+func TestNATSCluster(t *testing.T) {
+	servers, err := StartNATSCluster(3, NATSServerOptions{Username: "nats", Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to start cluster: %s", err)
+	}
+	t.Cleanup(func() { ShutdownNATSCluster(servers) })
+
+	if len(ClusterURLs(servers)) != 3 {
+		t.Errorf("expected 3 URLs, got %v", ClusterURLs(servers))
+	}
+
+	subscriber := connectTo(t, servers[0].ConnectionInfo())
+	publisher := connectTo(t, servers[2].ConnectionInfo())
+
+	assertRoundTrip(t, subscriber, publisher)
+}
+
+func TestNATSServerLameDuck(t *testing.T) {
+	servers, err := StartNATSCluster(2, NATSServerOptions{})
+	if err != nil {
+		t.Fatalf("failed to start cluster: %s", err)
+	}
+	t.Cleanup(func() { ShutdownNATSCluster(servers) })
+
+	client := yagnats.NewClient()
+
+	lameDuck := make(chan bool, 1)
+	client.LameDuckCallback = func() {
+		lameDuck <- true
+	}
+
+	err = client.Connect(ClusterConnectionProvider(servers))
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	t.Cleanup(client.Disconnect)
+
+	servers[0].LameDuck()
+
+	select {
+	case <-lameDuck:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lame duck mode was never announced")
+	}
+}
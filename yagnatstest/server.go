@@ -0,0 +1,504 @@
+package yagnatstest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+	"github.com/cloudfoundry/yagnats/internal/subjects"
+)
+
+var ErrServerClosed = errors.New("server closed")
+
+const writeTimeout = 2 * time.Second
+
+// Server is an in-memory NATS server speaking the text protocol, for
+// testing clients end to end without a nats-server binary. Clients reach it
+// over net.Pipe through Dial or ConnectionInfo, or over loopback TCP once
+// Listen has been called.
+type Server struct {
+	// Username and Password, when set, must match those sent in CONNECT.
+	Username string
+	Password string
+
+	info     yagnats.ServerInfo
+	injected []string
+
+	clients   map[*client]struct{}
+	listeners []net.Listener
+	closed    bool
+
+	random *rand.Rand
+	lock   *sync.Mutex
+}
+
+type client struct {
+	conn      net.Conn
+	writeLock *sync.Mutex
+
+	// guarded by the server lock
+	connected     bool
+	verbose       bool
+	headers       bool
+	subscriptions map[string]*subscription
+}
+
+type subscription struct {
+	client  *client
+	subject string
+	queue   string
+	sid     string
+}
+
+func NewServer() *Server {
+	return &Server{
+		info: yagnats.ServerInfo{
+			ServerID:   "yagnatstest",
+			Version:    "2.0.0",
+			MaxPayload: 1024 * 1024,
+			Headers:    true,
+		},
+
+		clients: map[*client]struct{}{},
+
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		lock:   &sync.Mutex{},
+	}
+}
+
+// Dial connects a new client over net.Pipe. It has the signature of
+// ConnectionInfo.Dial; network and address are ignored.
+func (s *Server) Dial(network, address string) (net.Conn, error) {
+	s.lock.Lock()
+	closed := s.closed
+	s.lock.Unlock()
+
+	if closed {
+		return nil, ErrServerClosed
+	}
+
+	clientSide, serverSide := net.Pipe()
+	go s.serve(serverSide)
+
+	return clientSide, nil
+}
+
+// ConnectionInfo returns a provider that dials the server over net.Pipe
+// with the server's credentials.
+func (s *Server) ConnectionInfo() *yagnats.ConnectionInfo {
+	return &yagnats.ConnectionInfo{
+		Addr:     "yagnatstest:4222",
+		Username: s.Username,
+		Password: s.Password,
+		Dial:     s.Dial,
+	}
+}
+
+// Listen accepts clients on a random loopback port and returns its address.
+func (s *Server) Listen() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		listener.Close()
+		return "", ErrServerClosed
+	}
+	s.listeners = append(s.listeners, listener)
+	s.lock.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return listener.Addr().String(), nil
+}
+
+// Close stops listening and disconnects every client.
+func (s *Server) Close() {
+	s.lock.Lock()
+	s.closed = true
+	listeners := s.listeners
+	s.listeners = nil
+	s.lock.Unlock()
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+
+	s.DisconnectClients()
+}
+
+// DisconnectClients closes every client connection, as a server restart
+// would. Clients may connect again straight away.
+func (s *Server) DisconnectClients() {
+	for _, c := range s.snapshotClients(false) {
+		c.conn.Close()
+	}
+}
+
+// InjectError answers the next acknowledged client operation (CONNECT, SUB,
+// UNSUB, PUB) with -ERR message instead of +OK. Errors queue up in order.
+func (s *Server) InjectError(message string) {
+	s.lock.Lock()
+	s.injected = append(s.injected, message)
+	s.lock.Unlock()
+}
+
+// UpdateInfo changes the server's INFO and sends it to every connected
+// client, for instance to announce lame duck mode.
+func (s *Server) UpdateInfo(update func(*yagnats.ServerInfo)) {
+	s.lock.Lock()
+	update(&s.info)
+	packet := s.infoPacket()
+	s.lock.Unlock()
+
+	for _, c := range s.snapshotClients(true) {
+		c.write(packet)
+	}
+}
+
+func (s *Server) ClientCount() int {
+	return len(s.snapshotClients(true))
+}
+
+func (s *Server) SubscriptionCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	for c := range s.clients {
+		count += len(c.subscriptions)
+	}
+
+	return count
+}
+
+func (s *Server) snapshotClients(connectedOnly bool) []*client {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	clients := []*client{}
+	for c := range s.clients {
+		if c.connected || !connectedOnly {
+			clients = append(clients, c)
+		}
+	}
+
+	return clients
+}
+
+// infoPacket is called with the lock held.
+func (s *Server) infoPacket() []byte {
+	info := s.info
+	info.AuthRequired = s.Username != "" || s.Password != ""
+
+	payload, err := json.Marshal(info)
+	if err != nil {
+		panic("invalid JSON info payload")
+	}
+
+	return (&yagnats.InfoPacket{Payload: string(payload)}).Encode()
+}
+
+func (s *Server) serve(conn net.Conn) {
+	c := &client{
+		conn:          conn,
+		writeLock:     &sync.Mutex{},
+		subscriptions: map[string]*subscription{},
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		conn.Close()
+		return
+	}
+	s.clients[c] = struct{}{}
+	info := s.infoPacket()
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.clients, c)
+		s.lock.Unlock()
+
+		conn.Close()
+	}()
+
+	if c.write(info) != nil {
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		err = s.handle(c, strings.TrimRight(line, "\r\n"), reader)
+		if err != nil {
+			c.write((&yagnats.ERRPacket{Message: err.Error()}).Encode())
+			return
+		}
+	}
+}
+
+type connectPayload struct {
+	User    string `json:"user"`
+	Pass    string `json:"pass"`
+	Verbose bool   `json:"verbose"`
+	Headers bool   `json:"headers"`
+}
+
+// handle processes a single client operation. A returned error is sent to
+// the client, which is then disconnected.
+func (s *Server) handle(c *client, line string, reader *bufio.Reader) error {
+	op, args, _ := strings.Cut(line, " ")
+	fields := strings.Fields(args)
+
+	s.lock.Lock()
+	connected := c.connected
+	authRequired := s.Username != "" || s.Password != ""
+	s.lock.Unlock()
+
+	op = strings.ToUpper(op)
+
+	if !connected && authRequired && op != "CONNECT" {
+		return errors.New("Authorization Violation")
+	}
+
+	switch op {
+	case "CONNECT":
+		payload := connectPayload{}
+		err := json.Unmarshal([]byte(args), &payload)
+		if err != nil {
+			return errors.New("Invalid CONNECT")
+		}
+
+		if authRequired && (payload.User != s.Username || payload.Pass != s.Password) {
+			return errors.New("Authorization Violation")
+		}
+
+		s.lock.Lock()
+		c.connected = true
+		c.verbose = payload.Verbose
+		c.headers = payload.Headers
+		s.lock.Unlock()
+
+		return s.acknowledge(c)
+
+	case "PING":
+		return c.write((&yagnats.PongPacket{}).Encode())
+
+	case "PONG":
+		return nil
+
+	case "SUB":
+		if len(fields) < 2 || len(fields) > 3 {
+			return errors.New("Invalid SUB")
+		}
+
+		sub := &subscription{client: c, subject: fields[0], sid: fields[len(fields)-1]}
+		if len(fields) == 3 {
+			sub.queue = fields[1]
+		}
+
+		if !subjects.Valid(sub.subject) {
+			return s.reject(c, "Invalid Subject")
+		}
+
+		s.lock.Lock()
+		c.subscriptions[sub.sid] = sub
+		s.lock.Unlock()
+
+		return s.acknowledge(c)
+
+	case "UNSUB":
+		if len(fields) < 1 || len(fields) > 2 {
+			return errors.New("Invalid UNSUB")
+		}
+
+		s.lock.Lock()
+		delete(c.subscriptions, fields[0])
+		s.lock.Unlock()
+
+		return s.acknowledge(c)
+
+	case "PUB", "HPUB":
+		sizes := 1
+		if op == "HPUB" {
+			sizes = 2
+		}
+
+		if len(fields) < 1+sizes || len(fields) > 2+sizes {
+			return fmt.Errorf("Invalid %s", op)
+		}
+
+		subject, reply := fields[0], ""
+		if len(fields) == 2+sizes {
+			reply = fields[1]
+		}
+
+		var headerSize int
+		if op == "HPUB" {
+			size, err := strconv.Atoi(fields[len(fields)-2])
+			if err != nil || size < 0 {
+				return errors.New("Invalid HPUB")
+			}
+			headerSize = size
+		}
+
+		size, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil || size < headerSize {
+			return fmt.Errorf("Invalid %s", op)
+		}
+
+		s.lock.Lock()
+		maxPayload := s.info.MaxPayload
+		s.lock.Unlock()
+
+		if int64(size) > maxPayload {
+			return errors.New("Maximum Payload Violation")
+		}
+
+		data := make([]byte, size+2)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return err
+		}
+		data = data[:size]
+
+		if !subjects.ValidForPublish(subject) {
+			return s.reject(c, "Invalid Publish Subject")
+		}
+
+		s.route(subject, reply, headerSize, op == "HPUB", data)
+
+		return s.acknowledge(c)
+
+	default:
+		return errors.New("Unknown Protocol Operation")
+	}
+}
+
+// acknowledge answers an operation with +OK in verbose mode, or with the
+// next injected error.
+func (s *Server) acknowledge(c *client) error {
+	s.lock.Lock()
+	verbose := c.verbose
+
+	if len(s.injected) > 0 {
+		message := s.injected[0]
+		s.injected = s.injected[1:]
+		s.lock.Unlock()
+
+		return c.write((&yagnats.ERRPacket{Message: message}).Encode())
+	}
+	s.lock.Unlock()
+
+	if !verbose {
+		return nil
+	}
+
+	return c.write((&yagnats.OKPacket{}).Encode())
+}
+
+// reject sends -ERR without disconnecting, as the server does for invalid
+// subjects in pedantic mode.
+func (s *Server) reject(c *client, message string) error {
+	return c.write((&yagnats.ERRPacket{Message: message}).Encode())
+}
+
+// route delivers to every matching subscription outside a queue group and
+// to one randomly picked member of each matching queue group. Clients that
+// did not ask for headers in CONNECT get the message without them, as MSG.
+func (s *Server) route(subject, reply string, headerSize int, headers bool, data []byte) {
+	s.lock.Lock()
+
+	recipients := []*subscription{}
+	groups := map[string][]*subscription{}
+
+	for c := range s.clients {
+		for _, sub := range c.subscriptions {
+			if !yagnats.SubjectMatches(sub.subject, subject) {
+				continue
+			}
+
+			if sub.queue == "" {
+				recipients = append(recipients, sub)
+			} else {
+				key := sub.subject + " " + sub.queue
+				groups[key] = append(groups[key], sub)
+			}
+		}
+	}
+
+	for _, group := range groups {
+		recipients = append(recipients, group[s.random.Intn(len(group))])
+	}
+
+	wantHeaders := map[*subscription]bool{}
+	for _, sub := range recipients {
+		wantHeaders[sub] = sub.client.headers
+	}
+
+	s.lock.Unlock()
+
+	for _, sub := range recipients {
+		if headers && !wantHeaders[sub] {
+			sub.client.write(encodeMsg(subject, sub.sid, reply, 0, false, data[headerSize:]))
+			continue
+		}
+
+		sub.client.write(encodeMsg(subject, sub.sid, reply, headerSize, headers, data))
+	}
+}
+
+func encodeMsg(subject, sid, reply string, headerSize int, headers bool, data []byte) []byte {
+	if reply != "" {
+		reply = " " + reply
+	}
+
+	if headers {
+		return []byte(fmt.Sprintf("HMSG %s %s%s %d %d\r\n%s\r\n", subject, sid, reply, headerSize, len(data), data))
+	}
+
+	return []byte(fmt.Sprintf("MSG %s %s%s %d\r\n%s\r\n", subject, sid, reply, len(data), data))
+}
+
+// write gives up on clients that stop reading, closing their connection.
+func (c *client) write(packet []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	_, err := c.conn.Write(packet)
+	if err != nil {
+		c.conn.Close()
+	}
+
+	return err
+}
@@ -0,0 +1,288 @@
+package yagnatstest
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/yagnats"
+)
+
+// newServer closes the server after the clients from connect have
+// disconnected; the client would otherwise keep trying to reconnect.
+func newServer(t *testing.T) *Server {
+	server := NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func connect(t *testing.T, server *Server) *yagnats.Client {
+	client := yagnats.NewClient()
+
+	err := client.Connect(server.ConnectionInfo())
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+
+	t.Cleanup(client.Disconnect)
+
+	return client
+}
+
+func waitForMessage(t *testing.T, messages chan *yagnats.Message) *yagnats.Message {
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("did not receive a message")
+		return nil
+	}
+}
+
+func TestServerDeliversToWildcardSubscriptions(t *testing.T) {
+	server := newServer(t)
+
+	client := connect(t, server)
+
+	messages := make(chan *yagnats.Message, 10)
+	_, err := client.Subscribe("router.*", func(msg *yagnats.Message) {
+		messages <- msg
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+
+	err = client.PublishWithReplyTo("router.register", "reply", []byte("hello"))
+	if err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+
+	msg := waitForMessage(t, messages)
+	if msg.Subject != "router.register" || msg.ReplyTo != "reply" || string(msg.Payload) != "hello" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	client.Publish("router.register.extra", []byte("ignored"))
+	client.Publish("router.register", []byte("again"))
+
+	if msg := waitForMessage(t, messages); string(msg.Payload) != "again" {
+		t.Errorf("expected only the matching message, got %q", msg.Payload)
+	}
+}
+
+func TestServerDeliversToOneQueueMember(t *testing.T) {
+	server := newServer(t)
+
+	publisher := connect(t, server)
+
+	messages := make(chan string, 10)
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		connect(t, server).SubscribeWithQueue("work", "workers", func(*yagnats.Message) {
+			messages <- name
+		})
+	}
+
+	for i := 0; i < 5; i++ {
+		publisher.Publish("work", []byte("job"))
+	}
+
+	for i := 0; i < 5; i++ {
+		select {
+		case <-messages:
+		case <-time.After(time.Second):
+			t.Fatalf("received only %d of 5 messages", i)
+		}
+	}
+
+	select {
+	case name := <-messages:
+		t.Errorf("message delivered twice, last to %s", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServerRequiresCredentials(t *testing.T) {
+	server := newServer(t)
+	server.Username = "nats"
+	server.Password = "secret"
+
+	info := server.ConnectionInfo()
+	info.Password = "wrong"
+
+	err := yagnats.NewClient().Connect(info)
+	if err == nil || err.Error() != "Authorization Violation" {
+		t.Errorf("expected an authorization violation, got %v", err)
+	}
+
+	connect(t, server)
+}
+
+func TestServerInjectsErrors(t *testing.T) {
+	server := newServer(t)
+
+	client := connect(t, server)
+
+	server.InjectError("Permissions Violation")
+
+	_, err := client.Subscribe("foo", func(*yagnats.Message) {})
+	if err == nil || err.Error() != "Permissions Violation" {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+
+	_, err = client.Subscribe("foo", func(*yagnats.Message) {})
+	if err != nil {
+		t.Errorf("expected only one error to be injected, got %v", err)
+	}
+}
+
+func TestServerRejectsInvalidSubjects(t *testing.T) {
+	server := newServer(t)
+
+	client := connect(t, server)
+
+	err := client.Publish("foo.*", []byte("hi"))
+	if err == nil || err.Error() != "Invalid Publish Subject" {
+		t.Errorf("expected an invalid subject error, got %v", err)
+	}
+
+	_, err = client.Subscribe("foo.b*", func(*yagnats.Message) {})
+	if err == nil || err.Error() != "Invalid Subject" {
+		t.Errorf("expected an invalid subject error, got %v", err)
+	}
+}
+
+func TestServerStripsHeadersForClientsWithoutHeaderSupport(t *testing.T) {
+	server := newServer(t)
+
+	conn, err := server.Dial("tcp", "")
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+
+	reader := bufio.NewReader(conn)
+	reader.ReadString('\n')
+
+	io.WriteString(conn, "CONNECT {\"verbose\":false}\r\nSUB foo 1\r\nPING\r\n")
+
+	pong, _ := reader.ReadString('\n')
+	if pong != "PONG\r\n" {
+		t.Fatalf("expected PONG, got %q", pong)
+	}
+
+	msg := &yagnats.Message{
+		Subject: "foo",
+		Header:  yagnats.Header{"some-key": {"some-value"}},
+		Payload: []byte("hello"),
+	}
+
+	publisher := connect(t, server)
+
+	// the server delivers before it acknowledges the publish, and net.Pipe
+	// blocks it until the message is read
+	published := make(chan error, 1)
+	go func() {
+		published <- publisher.PublishMsg(msg)
+	}()
+
+	line, _ := reader.ReadString('\n')
+	payload, _ := reader.ReadString('\n')
+
+	if line+payload != "MSG foo 1 5\r\nhello\r\n" {
+		t.Errorf("expected a MSG without headers, got %q", line+payload)
+	}
+
+	err = <-published
+	if err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+}
+
+func TestServerDisconnectClientsMakesClientsResubscribe(t *testing.T) {
+	server := newServer(t)
+
+	client := connect(t, server)
+
+	reconnected := make(chan bool, 1)
+	client.ConnectedCallback = func() {
+		reconnected <- true
+	}
+
+	messages := make(chan *yagnats.Message, 10)
+	client.Subscribe("foo", func(msg *yagnats.Message) {
+		messages <- msg
+	})
+
+	server.DisconnectClients()
+
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		t.Fatal("client never reconnected")
+	}
+
+	if server.SubscriptionCount() != 1 {
+		t.Errorf("expected 1 subscription after reconnecting, got %d", server.SubscriptionCount())
+	}
+
+	err := client.Publish("foo", []byte("after reconnect"))
+	if err != nil {
+		t.Fatalf("failed to publish: %s", err)
+	}
+
+	if msg := waitForMessage(t, messages); string(msg.Payload) != "after reconnect" {
+		t.Errorf("unexpected message %q", msg.Payload)
+	}
+}
+
+func TestServerUpdateInfoAnnouncesLameDuckMode(t *testing.T) {
+	server := newServer(t)
+
+	client := yagnats.NewClient()
+
+	lameDuck := make(chan bool, 1)
+	client.LameDuckCallback = func() {
+		lameDuck <- true
+	}
+
+	err := client.Connect(server.ConnectionInfo())
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer client.Disconnect()
+
+	server.UpdateInfo(func(info *yagnats.ServerInfo) {
+		info.LameDuckMode = true
+	})
+
+	select {
+	case <-lameDuck:
+	case <-time.After(time.Second):
+		t.Fatal("lame duck mode was never announced")
+	}
+}
+
+func TestServerListensOnLoopback(t *testing.T) {
+	server := newServer(t)
+
+	addr, err := server.Listen()
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	client := yagnats.NewClient()
+
+	err = client.Connect(&yagnats.ConnectionInfo{Addr: addr})
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer client.Disconnect()
+
+	if !client.Ping() {
+		t.Error("expected Ping to succeed")
+	}
+}